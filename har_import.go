@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/har"
+
+	"gopkg.in/yaml.v2"
+)
+
+// harImport converts a HAR file into rules, and writes them as a config file
+func harImport(args []string) {
+	flags := flag.NewFlagSet("har-import", flag.ExitOnError)
+	output := flags.String("o", "", "path to the output config file. defaults to stdout")
+	matchRule := flags.String("match", "strict", "body match rule of converted rules, 'loose|strict'. recorded strings are matched literally in both")
+	maxBodySize := flags.Int("max-body", 64*1024, "response bodies larger than this are written into files under the output directory. 0 keeps all bodies inline")
+	headers := flags.String("headers", "", "comma separated request headers matched by converted rules")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s har-import [options] <file.har>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	fileDir := "."
+	if *output != "" {
+		fileDir = filepath.Dir(*output)
+	}
+	opts := har.Options{
+		MatchRule:   *matchRule,
+		MaxBodySize: *maxBodySize,
+		FileDir:     fileDir,
+	}
+	if *headers != "" {
+		opts.Headers = strings.Split(*headers, ",")
+	}
+
+	converted, err := har.ConvertFile(flags.Arg(0), opts)
+	if err != nil {
+		log.Fatalf("Failed to convert HAR file, err: %s", err.Error())
+	}
+
+	if *output == "" {
+		bytes, err := yaml.Marshal(&config.Config{Rules: converted})
+		if err != nil {
+			log.Fatalf("Failed to marshal rules, err: %s", err.Error())
+		}
+		os.Stdout.Write(bytes)
+		return
+	}
+
+	err = config.SaveConfigToFile(&config.Config{Rules: converted}, *output)
+	if err != nil {
+		log.Fatalf("Failed to write config file, err: %s", err.Error())
+	}
+	log.Printf("Converted %d rules into %s", len(converted), *output)
+}
@@ -1,57 +1,164 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 // Config represents the config of this application
 type Config struct {
-	Servers []ServerConfig
-	Rules   []Rule
+	Servers     []ServerConfig `yaml:",omitempty"`
+	Rules       []Rule
+	Har         []HarSource `yaml:",omitempty"`             // HAR files loaded as rules, after Rules
+	JournalSize int         `yaml:"journal_size,omitempty"` // number of requests kept in the journal, defaults to 1000. negative disables the journal
+	AdminAddr   string      `yaml:"admin_addr,omitempty"`   // address of a separate listener serving only admin endpoints, optional
+	Dir         string      `yaml:"-"`                      // directory of the config file, set when loaded from a file
+}
+
+// HarSource represents a HAR file, each entry of it is converted into a rule
+type HarSource struct {
+	File      string // path to the HAR file
+	MatchRule string `yaml:"match_rule,omitempty"` // 'loose|strict', body match rule of converted rules, defaults to strict
 }
 
 // ServerConfig represents the config for the HTTP(S) server
 type ServerConfig struct {
-	Addr     string
-	CertFile string `yaml:"cert_file,omitempty"` // path to the cert file
-	KeyFile  string `yaml:"key_file,omitempty"`  // path to the key file
+	Addr        string
+	CertFile    string       `yaml:"cert_file,omitempty"`     // path to the cert file
+	KeyFile     string       `yaml:"key_file,omitempty"`      // path to the key file
+	HTTP2       bool         `yaml:"http2,omitempty"`         // negotiates HTTP/2 over TLS, connection faults can't be injected into HTTP/2
+	MaxBodySize int64        `yaml:"max_body_size,omitempty"` // max size of request body in bytes, 0 means unlimited
+	NearMisses  int          `yaml:"near_misses,omitempty"`   // number of closest rules reported when no rule matches, 0 disables the report
+	Delay       *DelayRule   `yaml:",omitempty"`              // default delay of responses, used if a rule has no delay
+	Proxy       *ProxyConfig `yaml:",omitempty"`              // upstream of unmatched requests
+	Admin       bool         `yaml:",omitempty"`              // serves admin endpoints under /__admin/ besides the rules
+	Dir         string       `yaml:"-"`                       // directory relative paths in the server are resolved against, set when loaded from a file
+}
+
+// ProxyConfig represents the upstream unmatched requests are proxied to.
+// In record mode, unmatched requests are forwarded, and rules replaying the responses are appended to File.
+// In replay mode, only rules in File are used.
+type ProxyConfig struct {
+	Upstream string
+	Mode     string   // 'record|replay'
+	File     string   // YAML file of recorded rules
+	Headers  []string `yaml:",omitempty"` // request headers matched by recorded rules
 }
 
 // Rule represents a rule
 type Rule struct {
-	Name     string `yaml:",omitempty"`
-	Request  RequestRule
-	Response ResponseRule
+	ID           string `yaml:"id,omitempty"` // identifies the rule in the admin API, generated if empty
+	Name         string `yaml:",omitempty"`
+	Request      RequestRule
+	Response     ResponseRule   `yaml:",omitempty"`
+	Responses    []ResponseRule `yaml:",omitempty"`              // responses to repeated requests, instead of a single Response
+	ResponseMode string         `yaml:"response_mode,omitempty"` // 'sequence|cycle|random|weighted', defaults to sequence
+	Scenario     string         `yaml:",omitempty"`              // name of the scenario the rule takes part in
+	State        string         `yaml:",omitempty"`              // state the scenario must be in for the rule to match, any state if empty
+	NewState     string         `yaml:"new_state,omitempty"`     // state the scenario transitions to after the rule matches
+	Resource     *ResourceRule  `yaml:",omitempty"`              // serves an in-memory REST collection, instead of Request and Response
+	Dir          string         `yaml:"-"`                       // directory relative paths in the rule are resolved against, set when loaded from a file
+}
+
+// ResourceRule represents an in-memory REST collection.
+// POST and GET on Path create and list items, GET, PUT, PATCH and DELETE on Path/<id> manage a single item.
+type ResourceRule struct {
+	Path    string
+	IDField string `yaml:"id_field,omitempty"` // field holding the id of an item, defaults to id
+	IDType  string `yaml:"id_type,omitempty"`  // 'int|uuid', type of generated ids, defaults to int
+	Seed    string `yaml:",omitempty"`         // path to a YAML or JSON file with an array of initial items
 }
 
 // RequestRule represents request rule
 type RequestRule struct {
 	Path    string
-	Headers []HeaderRule
+	Query   []QueryRule  `yaml:",omitempty"`
+	Headers []HeaderRule `yaml:",omitempty"`
 	Method  string
-	Body    RequestBodyRule
+	Body    RequestBodyRule `yaml:",omitempty"`
 }
 
-// HeaderRule represents header rule
+// QueryRule represents the matching rule for a query parameter.
+// Exactly one of Value, Values and Regex should be set.
+type QueryRule struct {
+	Name   string
+	Value  string   `yaml:",omitempty"` // matches any value of the parameter exactly. '{{name,type}}' captures a variable
+	Values []string `yaml:",omitempty"` // matches all values of a repeated parameter exactly, in order
+	Regex  string   `yaml:",omitempty"` // matches any value of the parameter as a regex. '{{name,type}}' captures a variable
+}
+
+// HeaderRule represents header rule.
+// A rule either matches a header by Name, or matches "Key: value" strings with Include or Not.
 type HeaderRule struct {
-	Include string
-	Not     string
+	Include string `yaml:",omitempty"` // regex, matches if any header matches
+	Not     string `yaml:",omitempty"` // regex, matches if no header matches
+	Name    string `yaml:",omitempty"` // case-insensitive header name. The header must be present
+	Value   string `yaml:",omitempty"` // matches any value of the header exactly. '{{name,type}}' captures a variable
+	Regex   string `yaml:",omitempty"` // matches any value of the header as a regex. '{{name,type}}' captures a variable
 }
 
 // RequestBodyRule represents the matching rule for request body
 type RequestBodyRule struct {
-	MatchRule string `yaml:"match_rule"`
-	Value     interface{}
+	MatchRule string      `yaml:"match_rule,omitempty"`
+	Value     interface{} `yaml:",omitempty"`
 }
 
-// ResponseRule represents response rule
+// ResponseRule represents response rule.
+// Status, headers, file path and strings in body are Go templates, with the captured variables as data.
 type ResponseRule struct {
-	Status  int
-	Headers []string
-	File    string
-	Body    interface{}
+	Status      StatusCode  `yaml:",omitempty"`
+	Headers     []string    `yaml:",omitempty"`
+	File        string      `yaml:",omitempty"`
+	RenderFile  bool        `yaml:"render_file,omitempty"` // render contents of File as a template
+	Disposition string      `yaml:",omitempty"`            // 'inline' or 'attachment', sets Content-Disposition header for File
+	Body        interface{} `yaml:",omitempty"`            // object written as JSON
+	BodyRaw     string      `yaml:"body_raw,omitempty"`    // string written verbatim
+	BodyBase64  string      `yaml:"body_base64,omitempty"` // binary body encoded in base64, not rendered
+	Directory   string      `yaml:",omitempty"`            // serves files under this directory, by the part of path matched by '**'
+	Index       string      `yaml:",omitempty"`            // index file of Directory, defaults to index.html
+	Listing     bool        `yaml:",omitempty"`            // lists directories in Directory without an index file
+	Delay       *DelayRule  `yaml:",omitempty"`            // delay before responding
+	Fault       *FaultRule  `yaml:",omitempty"`            // breaks the response to test robustness of clients
+	Weight      int         `yaml:",omitempty"`            // weight of the response in weighted response mode
+}
+
+// FaultRule represents a fault injected into the response
+type FaultRule struct {
+	Type           string   // 'close|reset|hang|truncate|throttle|malformed'
+	Probability    *float64 `yaml:",omitempty"`                 // chance the fault happens, defaults to 1
+	After          int64    `yaml:",omitempty"`                 // truncate, bytes of body sent before closing the connection
+	BytesPerSecond int64    `yaml:"bytes_per_second,omitempty"` // throttle
+	StatusLine     string   `yaml:"status_line,omitempty"`      // malformed, defaults to 'HTTP/1.1 ??? Malformed'
+}
+
+// DelayRule represents the delay before a response is written.
+// Durations are written like '200ms' or '1.5s'.
+type DelayRule struct {
+	Distribution string        `yaml:",omitempty"`       // 'fixed|uniform|normal|lognormal', defaults to fixed
+	Fixed        time.Duration `yaml:",omitempty"`       // fixed
+	Min          time.Duration `yaml:",omitempty"`       // uniform
+	Max          time.Duration `yaml:",omitempty"`       // uniform, or upper limit of normal and lognormal
+	Mean         time.Duration `yaml:",omitempty"`       // normal
+	StdDev       time.Duration `yaml:"stddev,omitempty"` // normal
+	Median       time.Duration `yaml:",omitempty"`       // lognormal
+	Sigma        float64       `yaml:",omitempty"`       // lognormal, standard deviation of the natural logarithm
+}
+
+// StatusCode is the status code of a response, either a number or a template rendering a number.
+type StatusCode string
+
+// MarshalYAML writes numeric status codes as numbers
+func (s StatusCode) MarshalYAML() (interface{}, error) {
+	if code, err := strconv.Atoi(string(s)); err == nil {
+		return code, nil
+	}
+	return string(s), nil
 }
 
 // LoadConfigFromFile loads the config from a YAML file
@@ -71,5 +178,73 @@ func LoadConfigFromFile(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	dir, err := filepath.Abs(filepath.Dir(configPath))
+	if err != nil {
+		return nil, err
+	}
+	config.Dir = dir
+	for i := range config.Servers {
+		config.Servers[i].Dir = dir
+	}
+	for i := range config.Rules {
+		config.Rules[i].Dir = dir
+	}
+	for i := range config.Har {
+		if !filepath.IsAbs(config.Har[i].File) {
+			config.Har[i].File = filepath.Join(dir, config.Har[i].File)
+		}
+	}
+
 	return &config, nil
 }
+
+// SaveConfigToFile saves the config into a YAML file.
+// The file is written to a temporary file first then renamed, so readers never see a partially written file.
+func SaveConfigToFile(config *Config, configPath string) error {
+	bytes, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := configPath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, bytes, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, configPath)
+}
+
+// JSONValue converts maps decoded from YAML into maps with string keys, so they can be marshaled into JSON
+func JSONValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, sub := range v {
+			keyString, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key of map object must be of type string")
+			}
+			converted, err := JSONValue(sub)
+			if err != nil {
+				return nil, err
+			}
+			result[keyString] = converted
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, sub := range v {
+			converted, err := JSONValue(sub)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,131 @@
+package delay
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// Delay samples the delay of a response from a distribution
+type Delay interface {
+	Sample() time.Duration
+}
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+var rndMtx sync.Mutex
+
+// Compile compiles a delay rule into a Delay. nil is returned if rule is nil.
+func Compile(rule *config.DelayRule) (Delay, error) {
+	if rule == nil {
+		return nil, nil
+	}
+
+	switch rule.Distribution {
+	case "", "fixed":
+		if rule.Fixed < 0 {
+			return nil, fmt.Errorf("delay.fixed must not be negative")
+		}
+		return fixedDelay(rule.Fixed), nil
+
+	case "uniform":
+		if rule.Min < 0 || rule.Max < rule.Min {
+			return nil, fmt.Errorf("delay.min must not be negative, and delay.max must not be less than delay.min")
+		}
+		return &uniformDelay{min: rule.Min, max: rule.Max}, nil
+
+	case "normal":
+		if rule.Mean < 0 || rule.StdDev < 0 {
+			return nil, fmt.Errorf("delay.mean and delay.stddev must not be negative")
+		}
+		return &normalDelay{mean: rule.Mean, stdDev: rule.StdDev, max: rule.Max}, nil
+
+	case "lognormal":
+		if rule.Median <= 0 || rule.Sigma < 0 {
+			return nil, fmt.Errorf("delay.median must be positive, and delay.sigma must not be negative")
+		}
+		return &logNormalDelay{median: rule.Median, sigma: rule.Sigma, max: rule.Max}, nil
+
+	default:
+		return nil, fmt.Errorf("delay.distribution must be one of 'fixed', 'uniform', 'normal' and 'lognormal'")
+	}
+}
+
+// Sleep waits for a delay sampled from d, it returns early if ctx is done.
+func Sleep(ctx context.Context, d Delay) {
+	if d == nil {
+		return
+	}
+
+	duration := d.Sample()
+	if duration <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+type fixedDelay time.Duration
+
+func (d fixedDelay) Sample() time.Duration {
+	return time.Duration(d)
+}
+
+type uniformDelay struct {
+	min time.Duration
+	max time.Duration
+}
+
+func (d *uniformDelay) Sample() time.Duration {
+	rndMtx.Lock()
+	defer rndMtx.Unlock()
+	return d.min + time.Duration(rnd.Int63n(int64(d.max-d.min)+1))
+}
+
+type normalDelay struct {
+	mean   time.Duration
+	stdDev time.Duration
+	max    time.Duration // 0 means unlimited
+}
+
+func (d *normalDelay) Sample() time.Duration {
+	rndMtx.Lock()
+	n := rnd.NormFloat64()
+	rndMtx.Unlock()
+
+	return clamp(time.Duration(float64(d.mean)+n*float64(d.stdDev)), d.max)
+}
+
+type logNormalDelay struct {
+	median time.Duration
+	sigma  float64
+	max    time.Duration // 0 means unlimited
+}
+
+func (d *logNormalDelay) Sample() time.Duration {
+	rndMtx.Lock()
+	n := rnd.NormFloat64()
+	rndMtx.Unlock()
+
+	return clamp(time.Duration(float64(d.median)*math.Exp(d.sigma*n)), d.max)
+}
+
+// clamp limits a sampled duration into [0, max], max of 0 means unlimited
+func clamp(duration time.Duration, max time.Duration) time.Duration {
+	if duration < 0 {
+		return 0
+	}
+	if max > 0 && duration > max {
+		return max
+	}
+	return duration
+}
@@ -0,0 +1,137 @@
+package delay
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// seed makes samples of the package's random source repeatable
+func seed(s int64) {
+	rndMtx.Lock()
+	defer rndMtx.Unlock()
+	rnd = rand.New(rand.NewSource(s))
+}
+
+func compile(t *testing.T, rule config.DelayRule) Delay {
+	t.Helper()
+
+	d, err := Compile(&rule)
+	if err != nil {
+		t.Fatalf("failed to compile %+v: %s", rule, err)
+	}
+	return d
+}
+
+// samples returns n sorted samples of d
+func samples(d Delay, n int) []time.Duration {
+	sampled := make([]time.Duration, n)
+	for i := range sampled {
+		sampled[i] = d.Sample()
+	}
+	sort.Slice(sampled, func(i, j int) bool { return sampled[i] < sampled[j] })
+	return sampled
+}
+
+func TestCompileInvalidDelay(t *testing.T) {
+	rules := []config.DelayRule{
+		{Fixed: -time.Second},
+		{Distribution: "uniform", Min: 2 * time.Second, Max: time.Second},
+		{Distribution: "uniform", Min: -time.Second},
+		{Distribution: "normal", Mean: -time.Second},
+		{Distribution: "normal", Mean: time.Second, StdDev: -time.Second},
+		{Distribution: "lognormal"},
+		{Distribution: "lognormal", Median: time.Second, Sigma: -1},
+		{Distribution: "poisson"},
+	}
+
+	for _, rule := range rules {
+		if _, err := Compile(&rule); err == nil {
+			t.Errorf("%+v: expected an error", rule)
+		}
+	}
+
+	d, err := Compile(nil)
+	if d != nil || err != nil {
+		t.Errorf("expected no delay for no rule, got %v %v", d, err)
+	}
+}
+
+func TestSampleBounds(t *testing.T) {
+	seed(1)
+
+	tests := []struct {
+		rule   config.DelayRule
+		min    time.Duration
+		max    time.Duration
+		median time.Duration // checked with 10% tolerance if set
+	}{
+		{config.DelayRule{Fixed: 50 * time.Millisecond}, 50 * time.Millisecond, 50 * time.Millisecond, 0},
+		{config.DelayRule{Distribution: "uniform", Min: 10 * time.Millisecond, Max: 30 * time.Millisecond}, 10 * time.Millisecond, 30 * time.Millisecond, 20 * time.Millisecond},
+		{config.DelayRule{Distribution: "uniform", Min: 10 * time.Millisecond, Max: 10 * time.Millisecond}, 10 * time.Millisecond, 10 * time.Millisecond, 0},
+		{config.DelayRule{Distribution: "normal", Mean: 100 * time.Millisecond, StdDev: 10 * time.Millisecond}, 0, time.Duration(1<<63 - 1), 100 * time.Millisecond},
+		{config.DelayRule{Distribution: "normal", Mean: 10 * time.Millisecond, StdDev: 100 * time.Millisecond, Max: 50 * time.Millisecond}, 0, 50 * time.Millisecond, 0},
+		{config.DelayRule{Distribution: "normal", Mean: time.Hour, Max: time.Second}, time.Second, time.Second, 0},
+		{config.DelayRule{Distribution: "lognormal", Median: 100 * time.Millisecond, Sigma: 0.5}, 1, time.Duration(1<<63 - 1), 100 * time.Millisecond},
+		{config.DelayRule{Distribution: "lognormal", Median: 100 * time.Millisecond, Sigma: 2, Max: 200 * time.Millisecond}, 1, 200 * time.Millisecond, 0},
+	}
+
+	for _, test := range tests {
+		sampled := samples(compile(t, test.rule), 2000)
+		if sampled[0] < test.min || sampled[len(sampled)-1] > test.max {
+			t.Errorf("%+v: expected samples in [%s, %s], got [%s, %s]", test.rule, test.min, test.max, sampled[0], sampled[len(sampled)-1])
+		}
+		if test.median > 0 {
+			median := sampled[len(sampled)/2]
+			if median < test.median*9/10 || median > test.median*11/10 {
+				t.Errorf("%+v: expected median around %s, got %s", test.rule, test.median, median)
+			}
+		}
+	}
+}
+
+func TestSampleIsRepeatableWithSeed(t *testing.T) {
+	d := compile(t, config.DelayRule{Distribution: "lognormal", Median: 100 * time.Millisecond, Sigma: 1})
+
+	seed(42)
+	first := []time.Duration{d.Sample(), d.Sample(), d.Sample()}
+	seed(42)
+	second := []time.Duration{d.Sample(), d.Sample(), d.Sample()}
+
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same samples with the same seed, got %v and %v", first, second)
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	start := time.Now()
+	Sleep(context.Background(), compile(t, config.DelayRule{Fixed: 20 * time.Millisecond}))
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected to sleep at least 20ms, slept %s", elapsed)
+	}
+
+	Sleep(context.Background(), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start = time.Now()
+	Sleep(ctx, compile(t, config.DelayRule{Fixed: time.Minute}))
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected Sleep to return when the context is cancelled, slept %s", elapsed)
+	}
+
+	start = time.Now()
+	Sleep(ctx, compile(t, config.DelayRule{Fixed: time.Minute}))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Sleep to return immediately with a cancelled context, slept %s", elapsed)
+	}
+}
@@ -0,0 +1,95 @@
+package fault
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// Type is the type of a fault
+type Type string
+
+// Supported fault types
+const (
+	Close     Type = "close"     // close the connection without a response
+	Reset     Type = "reset"     // reset the TCP connection
+	Hang      Type = "hang"      // send status and headers, then hang until the client gives up
+	Truncate  Type = "truncate"  // send Content-Length of the whole body, but close the connection after some bytes
+	Throttle  Type = "throttle"  // send the body slowly
+	Malformed Type = "malformed" // send a malformed status line
+)
+
+// DefaultStatusLine is the status line of malformed responses if none is configured
+const DefaultStatusLine = "HTTP/1.1 ??? Malformed"
+
+// Fault is compiled from config.FaultRule
+type Fault struct {
+	Type           Type
+	Probability    float64
+	After          int64  // bytes of body sent before truncating
+	BytesPerSecond int64  // bandwidth of throttled responses
+	StatusLine     string // status line of malformed responses
+}
+
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+var rndMtx sync.Mutex
+
+// Compile compiles a fault rule into a Fault. nil is returned if rule is nil.
+func Compile(rule *config.FaultRule) (*Fault, error) {
+	if rule == nil {
+		return nil, nil
+	}
+
+	f := &Fault{
+		Type:           Type(rule.Type),
+		Probability:    1,
+		After:          rule.After,
+		BytesPerSecond: rule.BytesPerSecond,
+		StatusLine:     rule.StatusLine,
+	}
+
+	if rule.Probability != nil {
+		if *rule.Probability < 0 || *rule.Probability > 1 {
+			return nil, fmt.Errorf("fault.probability must be between 0 and 1")
+		}
+		f.Probability = *rule.Probability
+	}
+
+	switch f.Type {
+	case Close, Reset, Hang:
+
+	case Truncate:
+		if f.After < 0 {
+			return nil, fmt.Errorf("fault.after must not be negative")
+		}
+
+	case Throttle:
+		if f.BytesPerSecond <= 0 {
+			return nil, fmt.Errorf("fault.bytes_per_second must be positive")
+		}
+
+	case Malformed:
+		if f.StatusLine == "" {
+			f.StatusLine = DefaultStatusLine
+		}
+
+	default:
+		return nil, fmt.Errorf("fault.type must be one of 'close', 'reset', 'hang', 'truncate', 'throttle' and 'malformed'")
+	}
+
+	return f, nil
+}
+
+// Triggered decides by probability whether the fault happens to a response
+func (f *Fault) Triggered() bool {
+	if f.Probability >= 1 {
+		return true
+	}
+
+	rndMtx.Lock()
+	defer rndMtx.Unlock()
+	return rnd.Float64() < f.Probability
+}
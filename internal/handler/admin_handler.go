@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/journal"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// AdminPathPrefix is the path prefix of admin endpoints, served by every server
+const AdminPathPrefix = "/__admin/"
+
+// AdminHandler handles requests to admin endpoints
+type AdminHandler struct {
+	Rules   *rules.AtomicRuleSet
+	Journal *journal.Journal // nil if the journal is disabled
+	Dir     string           // directory relative paths in rules created at runtime are resolved against
+	Reloads *ReloadStatus    // results of loading rules from the config, nil if not recorded
+}
+
+func (ah *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Admin request: %s %s", r.Method, r.RequestURI)
+
+	switch {
+	case r.URL.Path == AdminPathPrefix+"responses/reset" && r.Method == http.MethodPost:
+		ah.resetResponses(w, r)
+
+	case r.URL.Path == AdminPathPrefix+"scenarios" && r.Method == http.MethodGet:
+		ah.listScenarios(w, r)
+
+	case r.URL.Path == AdminPathPrefix+"scenarios/reset" && r.Method == http.MethodPost:
+		ah.resetScenarios(w, r)
+
+	case strings.HasPrefix(r.URL.Path, AdminPathPrefix+"scenarios/") && r.Method == http.MethodPut:
+		ah.setScenarioState(w, r)
+
+	case r.URL.Path == AdminPathPrefix+"requests" && r.Method == http.MethodGet && ah.Journal != nil:
+		ah.listRequests(w, r)
+
+	case r.URL.Path == AdminPathPrefix+"requests" && r.Method == http.MethodDelete && ah.Journal != nil:
+		ah.Journal.Reset()
+		jsonResponse(http.StatusOK, []journal.Entry{}, w)
+
+	case r.URL.Path == AdminPathPrefix+"rules" || strings.HasPrefix(r.URL.Path, AdminPathPrefix+"rules/"):
+		ah.serveRules(w, r)
+
+	case r.URL.Path == AdminPathPrefix+"reload" && r.Method == http.MethodGet && ah.Reloads != nil:
+		jsonResponse(http.StatusOK, ah.Reloads.snapshot(), w)
+
+	case r.URL.Path == AdminPathPrefix+"verify" && r.Method == http.MethodPost:
+		ah.verify(w, r)
+
+	default:
+		errorResponse(http.StatusNotFound, fmt.Sprintf("unknown admin endpoint: %s %s", r.Method, r.URL.Path), w)
+	}
+}
+
+// resetResponses restarts response sequences of all rules, or of rules named by the 'rule' query parameter
+func (ah *AdminHandler) resetResponses(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("rule")
+
+	count := ah.Rules.Load().ResetResponses(name)
+
+	jsonResponse(http.StatusOK, map[string]interface{}{"reset": count}, w)
+}
+
+func (ah *AdminHandler) scenarios() *rules.Scenarios {
+	return ah.Rules.Load().Scenarios()
+}
+
+// listScenarios responses current states of all scenarios
+func (ah *AdminHandler) listScenarios(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(http.StatusOK, ah.scenarios().States(), w)
+}
+
+// resetScenarios puts all scenarios, or the one named by the 'scenario' query parameter back into the started state
+func (ah *AdminHandler) resetScenarios(w http.ResponseWriter, r *http.Request) {
+	scenarios := ah.scenarios()
+	scenarios.Reset(r.URL.Query().Get("scenario"))
+	jsonResponse(http.StatusOK, scenarios.States(), w)
+}
+
+// setScenarioState changes state of the scenario in path to the state in body, e.g. {"state": "paid"}
+func (ah *AdminHandler) setScenarioState(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, AdminPathPrefix+"scenarios/")
+	if name == "" {
+		errorResponse(http.StatusBadRequest, "scenario name is missing in path", w)
+		return
+	}
+	scenarios := ah.scenarios()
+	if !scenarios.Declared(name) {
+		errorResponse(http.StatusBadRequest, fmt.Sprintf("no rule declares scenario '%s'", name), w)
+		return
+	}
+
+	body := struct {
+		State string `json:"state"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil || body.State == "" {
+		errorResponse(http.StatusBadRequest, "request body must be like {\"state\": \"<state>\"}", w)
+		return
+	}
+
+	scenarios.SetState(name, body.State)
+	warnRuntimeChange(w)
+	jsonResponse(http.StatusOK, scenarios.States(), w)
+}
+
+// listRequests responses journal entries, filtered by query parameters:
+// 'rule', 'method', 'server', 'path' as a regex, 'since' and 'until' as RFC3339 times or durations ago, and 'limit'
+func (ah *AdminHandler) listRequests(w http.ResponseWriter, r *http.Request) {
+	filter, err := journalFilter(r.URL.Query())
+	if err != nil {
+		errorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	jsonResponse(http.StatusOK, ah.Journal.Entries(filter), w)
+}
+
+func journalFilter(query url.Values) (journal.Filter, error) {
+	filter := journal.Filter{
+		Rule:   query.Get("rule"),
+		Method: query.Get("method"),
+		Server: query.Get("server"),
+	}
+
+	var err error
+	if path := query.Get("path"); path != "" {
+		filter.Path, err = regexp.Compile(path)
+		if err != nil {
+			return filter, fmt.Errorf("path must be a regex, err: %s", err.Error())
+		}
+	}
+
+	filter.Since, err = parseTime(query.Get("since"))
+	if err != nil {
+		return filter, err
+	}
+	filter.Until, err = parseTime(query.Get("until"))
+	if err != nil {
+		return filter, err
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return filter, fmt.Errorf("limit must be an integer, actual: %s", limit)
+		}
+	}
+
+	return filter, nil
+}
+
+// parseTime parses a RFC3339 time, or a duration like '5m' meaning that long ago
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("time must be RFC3339 or a duration, actual: %s", value)
+	}
+	return t, nil
+}
+
+// jsonResponse responses statusCode, and body as obj marshaled into JSON
+func jsonResponse(statusCode int, obj interface{}, w http.ResponseWriter) {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal obj into json, err: %s", err.Error()), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(bytes)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// newTestAdminHandler creates an admin handler of rules
+func newTestAdminHandler(t *testing.T, configRules ...config.Rule) *AdminHandler {
+	t.Helper()
+	return &AdminHandler{Rules: newTestHandler(t, config.ServerConfig{}, configRules...).Rules}
+}
+
+// serve serves a request by h, and returns the status and body of the response
+func serve(h http.Handler, method string, target string, body string) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	resp := w.Result()
+	bytes, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(bytes)
+}
+
+func TestScenarios(t *testing.T) {
+	h := newTestAdminHandler(t,
+		config.Rule{
+			Request:  config.RequestRule{Method: "POST", Path: "/order"},
+			Scenario: "checkout",
+			NewState: "created",
+		},
+		config.Rule{
+			Request:  config.RequestRule{Method: "GET", Path: "/login"},
+			Scenario: "session",
+		},
+	)
+
+	checkStates := func(t *testing.T, body string, expected map[string]string) {
+		t.Helper()
+		states := map[string]string{}
+		err := json.Unmarshal([]byte(body), &states)
+		if err != nil {
+			t.Fatalf("expected states in JSON, got %q", body)
+		}
+		if diff := cmp.Diff(expected, states); diff != "" {
+			t.Errorf("unexpected states (-expected +actual):\n%s", diff)
+		}
+	}
+
+	status, body := serve(h, "GET", "/__admin/scenarios", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", status, body)
+	}
+	checkStates(t, body, map[string]string{"checkout": "Started", "session": "Started"})
+
+	status, body = serve(h, "PUT", "/__admin/scenarios/checkout", `{"state": "paid"}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", status, body)
+	}
+	checkStates(t, body, map[string]string{"checkout": "paid", "session": "Started"})
+
+	serve(h, "PUT", "/__admin/scenarios/session", `{"state": "logged in"}`)
+	status, body = serve(h, "POST", "/__admin/scenarios/reset?scenario=checkout", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", status, body)
+	}
+	checkStates(t, body, map[string]string{"checkout": "Started", "session": "logged in"})
+
+	serve(h, "PUT", "/__admin/scenarios/checkout", `{"state": "paid"}`)
+	_, body = serve(h, "POST", "/__admin/scenarios/reset", "")
+	checkStates(t, body, map[string]string{"checkout": "Started", "session": "Started"})
+
+	invalid := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{name: "empty name", target: "/__admin/scenarios/", body: `{"state": "paid"}`},
+		{name: "undeclared scenario", target: "/__admin/scenarios/unknown", body: `{"state": "paid"}`},
+		{name: "empty state", target: "/__admin/scenarios/checkout", body: `{"state": ""}`},
+		{name: "invalid body", target: "/__admin/scenarios/checkout", body: `paid`},
+	}
+	for _, test := range invalid {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := serve(h, "PUT", test.target, test.body)
+			if status != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d %s", status, body)
+			}
+		})
+	}
+
+	_, body = serve(h, "GET", "/__admin/scenarios", "")
+	checkStates(t, body, map[string]string{"checkout": "Started", "session": "Started"})
+}
+
+func TestRuntimeChangesAreWarned(t *testing.T) {
+	h := newTestAdminHandler(t, config.Rule{
+		ID:       "order",
+		Request:  config.RequestRule{Method: "POST", Path: "/order"},
+		Scenario: "checkout",
+	})
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+		status int
+		warned bool
+	}{
+		{method: "GET", target: "/__admin/rules", status: http.StatusOK, warned: false},
+		{method: "POST", target: "/__admin/rules", body: `{"id": "hello", "request": {"method": "GET", "path": "/hello"}}`, status: http.StatusCreated, warned: true},
+		{method: "PUT", target: "/__admin/rules/hello", body: `{"request": {"method": "GET", "path": "/hi"}}`, status: http.StatusOK, warned: true},
+		{method: "POST", target: "/__admin/rules/reorder", body: `["hello", "order"]`, status: http.StatusOK, warned: true},
+		{method: "DELETE", target: "/__admin/rules/hello", status: http.StatusOK, warned: true},
+		{method: "DELETE", target: "/__admin/rules/hello", status: http.StatusNotFound, warned: false},
+		{method: "PUT", target: "/__admin/scenarios/checkout", body: `{"state": "paid"}`, status: http.StatusOK, warned: true},
+		{method: "GET", target: "/__admin/scenarios", status: http.StatusOK, warned: false},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+		if w.Code != test.status {
+			t.Fatalf("%s %s: expected %d, got %d %s", test.method, test.target, test.status, w.Code, w.Body.String())
+		}
+		if warned := w.Header().Get("Warning") != ""; warned != test.warned {
+			t.Errorf("%s %s: expected warned %v, got Warning %q", test.method, test.target, test.warned, w.Header().Get("Warning"))
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/rules"
+
+	"gopkg.in/yaml.v2"
+)
+
+// serveRules serves endpoints managing rules at runtime:
+// GET rules lists rules, POST rules creates a rule, at the end or at the 'index' query parameter,
+// POST rules/reorder reorders rules by a list of all rule ids,
+// GET, PUT and DELETE rules/<id> manage a single rule.
+// Rules are written in YAML or JSON, same as rules in a config file.
+func (ah *AdminHandler) serveRules(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, AdminPathPrefix+"rules"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		ah.listRules(w)
+
+	case id == "" && r.Method == http.MethodPost:
+		ah.createRule(w, r)
+
+	case id == "reorder" && r.Method == http.MethodPost:
+		ah.reorderRules(w, r)
+
+	case id != "" && r.Method == http.MethodGet:
+		ah.getRule(id, w)
+
+	case id != "" && r.Method == http.MethodPut:
+		ah.updateRule(id, w, r)
+
+	case id != "" && r.Method == http.MethodDelete:
+		ah.deleteRule(id, w)
+
+	default:
+		errorResponse(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed on %s", r.Method, r.URL.Path), w)
+	}
+}
+
+func (ah *AdminHandler) listRules(w http.ResponseWriter) {
+	compiledRules := ah.Rules.Load().Rules()
+
+	list := make([]interface{}, len(compiledRules))
+	for i, rule := range compiledRules {
+		obj, err := ruleObject(rule)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, err.Error(), w)
+			return
+		}
+		list[i] = obj
+	}
+	jsonResponse(http.StatusOK, list, w)
+}
+
+func (ah *AdminHandler) getRule(id string, w http.ResponseWriter) {
+	compiledRules := ah.Rules.Load().Rules()
+	index := findRule(compiledRules, id)
+	if index < 0 {
+		errorResponse(http.StatusNotFound, fmt.Sprintf("rule not found: %s", id), w)
+		return
+	}
+	ah.ruleResponse(http.StatusOK, compiledRules[index], w)
+}
+
+func (ah *AdminHandler) createRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := ah.compileRequestRule(r, "")
+	if err != nil {
+		errorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	err = ah.Rules.Update(func(current *rules.RuleSet) (*rules.RuleSet, error) {
+		compiledRules := current.Rules()
+		index := len(compiledRules)
+		if value := r.URL.Query().Get("index"); value != "" {
+			var parseErr error
+			index, parseErr = strconv.Atoi(value)
+			if parseErr != nil || index < 0 || index > len(compiledRules) {
+				return nil, &adminError{http.StatusBadRequest, fmt.Sprintf("index must be an integer in [0, %d], actual: %s", len(compiledRules), value)}
+			}
+		}
+		if findRule(compiledRules, rule.ID) >= 0 {
+			return nil, &adminError{http.StatusConflict, fmt.Sprintf("rule already exists: %s", rule.ID)}
+		}
+
+		newRules := make([]*rules.CompiledRule, 0, len(compiledRules)+1)
+		newRules = append(newRules, compiledRules[:index]...)
+		newRules = append(newRules, rule)
+		newRules = append(newRules, compiledRules[index:]...)
+		return current.WithRules(newRules), nil
+	})
+	if err != nil {
+		adminErrorResponse(err, w)
+		return
+	}
+
+	warnRuntimeChange(w)
+	ah.ruleResponse(http.StatusCreated, rule, w)
+}
+
+func (ah *AdminHandler) updateRule(id string, w http.ResponseWriter, r *http.Request) {
+	rule, err := ah.compileRequestRule(r, id)
+	if err != nil {
+		errorResponse(http.StatusBadRequest, err.Error(), w)
+		return
+	}
+
+	err = ah.Rules.Update(func(current *rules.RuleSet) (*rules.RuleSet, error) {
+		compiledRules := current.Rules()
+		index := findRule(compiledRules, id)
+		if index < 0 {
+			return nil, &adminError{http.StatusNotFound, fmt.Sprintf("rule not found: %s", id)}
+		}
+
+		newRules := make([]*rules.CompiledRule, len(compiledRules))
+		copy(newRules, compiledRules)
+		newRules[index] = rule
+		return current.WithRules(newRules), nil
+	})
+	if err != nil {
+		adminErrorResponse(err, w)
+		return
+	}
+
+	warnRuntimeChange(w)
+	ah.ruleResponse(http.StatusOK, rule, w)
+}
+
+func (ah *AdminHandler) deleteRule(id string, w http.ResponseWriter) {
+	var rule *rules.CompiledRule
+	err := ah.Rules.Update(func(current *rules.RuleSet) (*rules.RuleSet, error) {
+		compiledRules := current.Rules()
+		index := findRule(compiledRules, id)
+		if index < 0 {
+			return nil, &adminError{http.StatusNotFound, fmt.Sprintf("rule not found: %s", id)}
+		}
+
+		rule = compiledRules[index]
+		newRules := make([]*rules.CompiledRule, 0, len(compiledRules)-1)
+		newRules = append(newRules, compiledRules[:index]...)
+		newRules = append(newRules, compiledRules[index+1:]...)
+		return current.WithRules(newRules), nil
+	})
+	if err != nil {
+		adminErrorResponse(err, w)
+		return
+	}
+
+	warnRuntimeChange(w)
+	ah.ruleResponse(http.StatusOK, rule, w)
+}
+
+// reorderRules reorders rules by a list of ids in body, e.g. ["id-2", "id-1"], which must contain every rule once
+func (ah *AdminHandler) reorderRules(w http.ResponseWriter, r *http.Request) {
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorResponse(http.StatusBadRequest, fmt.Sprintf("Failed to read request body, err: %s", err.Error()), w)
+		return
+	}
+
+	ids := make([]string, 0)
+	err = yaml.Unmarshal(bodyBytes, &ids)
+	if err != nil {
+		errorResponse(http.StatusBadRequest, "request body must be a list of rule ids", w)
+		return
+	}
+
+	err = ah.Rules.Update(func(current *rules.RuleSet) (*rules.RuleSet, error) {
+		compiledRules := current.Rules()
+		if len(ids) != len(compiledRules) {
+			return nil, &adminError{http.StatusBadRequest, fmt.Sprintf("request body must contain ids of all %d rules, actual: %d", len(compiledRules), len(ids))}
+		}
+
+		newRules := make([]*rules.CompiledRule, len(ids))
+		for i, id := range ids {
+			index := findRule(compiledRules, id)
+			if index < 0 || findRule(newRules[:i], id) >= 0 {
+				return nil, &adminError{http.StatusBadRequest, fmt.Sprintf("unknown or duplicated rule id: %s", id)}
+			}
+			newRules[i] = compiledRules[index]
+		}
+		return current.WithRules(newRules), nil
+	})
+	if err != nil {
+		adminErrorResponse(err, w)
+		return
+	}
+
+	warnRuntimeChange(w)
+	ah.listRules(w)
+}
+
+// runtimeChangeWarning warns clients that rules and scenario states changed at runtime are lost by reloads
+const runtimeChangeWarning = `299 - "changes made at runtime are discarded when the config file is reloaded"`
+
+// warnRuntimeChange sets the Warning header of a response to a request changing rules or scenario states
+func warnRuntimeChange(w http.ResponseWriter) {
+	w.Header().Set("Warning", runtimeChangeWarning)
+}
+
+// adminError is an error responded with a status code
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+func adminErrorResponse(err error, w http.ResponseWriter) {
+	if ae, ok := err.(*adminError); ok {
+		errorResponse(ae.status, ae.message, w)
+		return
+	}
+	errorResponse(http.StatusInternalServerError, err.Error(), w)
+}
+
+// compileRequestRule decodes a rule from the request body and compiles it.
+// id of the rule is set to id if it's not empty, relative paths are resolved against ah.Dir.
+func (ah *AdminHandler) compileRequestRule(r *http.Request, id string) (*rules.CompiledRule, error) {
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read request body, err: %s", err.Error())
+	}
+
+	rule := config.Rule{}
+	err = yaml.Unmarshal(bodyBytes, &rule)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode rule, err: %s", err.Error())
+	}
+	if id != "" {
+		if rule.ID != "" && rule.ID != id {
+			return nil, fmt.Errorf("id of the rule doesn't match the path, expected: %s, actual: %s", id, rule.ID)
+		}
+		rule.ID = id
+	}
+	rule.Dir = ah.Dir
+
+	compiledRule, err := rules.CompileRule(rule)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile rule, err: %s", err.Error())
+	}
+	return compiledRule, nil
+}
+
+// findRule returns index of the rule with id, -1 if it's not found
+func findRule(compiledRules []*rules.CompiledRule, id string) int {
+	for i, rule := range compiledRules {
+		if rule != nil && rule.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (ah *AdminHandler) ruleResponse(statusCode int, rule *rules.CompiledRule, w http.ResponseWriter) {
+	obj, err := ruleObject(rule)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, err.Error(), w)
+		return
+	}
+	jsonResponse(statusCode, obj, w)
+}
+
+// ruleObject converts a rule into an object marshaled into JSON with the same field names as in a config file
+func ruleObject(rule *rules.CompiledRule) (interface{}, error) {
+	bytes, err := yaml.Marshal(rule.Config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal rule, err: %s", err.Error())
+	}
+
+	var obj interface{}
+	err = yaml.Unmarshal(bytes, &obj)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal rule, err: %s", err.Error())
+	}
+	return config.JSONValue(obj)
+}
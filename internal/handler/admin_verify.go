@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/journal"
+	"github.com/imafish/http-test-server/internal/rules"
+
+	"gopkg.in/yaml.v2"
+)
+
+// verifyNearMisses is the number of closest requests reported when a verification fails
+const verifyNearMisses = 3
+
+// verification represents the body of a verify request.
+// It's decoded by yaml, so the request pattern is decoded the same way as rules in a config file.
+type verification struct {
+	Request config.RequestRule `yaml:"request"`
+	Exactly *int               `yaml:"exactly"`
+	AtLeast *int               `yaml:"atLeast"`
+	AtMost  *int               `yaml:"atMost"`
+}
+
+type verifyNearMiss struct {
+	Request    journal.Entry `json:"request"`
+	Score      int           `json:"score"`
+	Mismatches []string      `json:"mismatches"`
+}
+
+type verifyReport struct {
+	Pass       bool             `json:"pass"`
+	Count      int              `json:"count"`
+	Expected   string           `json:"expected"`
+	Matched    []int64          `json:"matched"`               // ids of matched journal entries
+	NearMisses []verifyNearMiss `json:"near_misses,omitempty"` // requests closest to matching the pattern, only if the verification fails
+}
+
+// verify counts received requests matching the pattern in body, and checks the count is as expected.
+// e.g. {"request": {"path": "/users", "method": "POST"}, "atLeast": 1}
+// An omitted method matches any method, and at least 1 request is expected if no count is given.
+func (ah *AdminHandler) verify(w http.ResponseWriter, r *http.Request) {
+	if ah.Journal == nil {
+		errorResponse(http.StatusConflict, "requests can't be verified when the journal is disabled", w)
+		return
+	}
+
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorResponse(http.StatusBadRequest, fmt.Sprintf("Failed to read request body, err: %s", err.Error()), w)
+		return
+	}
+
+	v := verification{}
+	err = yaml.Unmarshal(bodyBytes, &v)
+	if err != nil {
+		errorResponse(http.StatusBadRequest, fmt.Sprintf("Failed to decode verification, err: %s", err.Error()), w)
+		return
+	}
+	if v.Request.Path == "" {
+		errorResponse(http.StatusBadRequest, "request.path of verification is manditory", w)
+		return
+	}
+	if v.Request.Method == "" {
+		v.Request.Method = "*"
+	}
+
+	pattern, err := rules.CompileRule(config.Rule{Name: "verification", Request: v.Request})
+	if err != nil {
+		errorResponse(http.StatusBadRequest, fmt.Sprintf("Failed to compile request pattern, err: %s", err.Error()), w)
+		return
+	}
+
+	report := verifyReport{Matched: make([]int64, 0)}
+	nearMisses := make([]verifyNearMiss, 0)
+	for _, entry := range ah.Journal.Entries(journal.Filter{}) {
+		request, body, err := entryRequest(&entry)
+		if err != nil {
+			continue
+		}
+
+		match, _, err := rules.MatchRequest(pattern, request, body)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("error in matching request %d, err: %s", entry.ID, err.Error()), w)
+			return
+		}
+		if match {
+			report.Matched = append(report.Matched, entry.ID)
+			continue
+		}
+
+		nm := rules.DiagnoseRequest(pattern, request, body)
+		nearMisses = append(nearMisses, verifyNearMiss{Request: entry, Score: nm.Score, Mismatches: nm.Mismatches})
+	}
+
+	report.Count = len(report.Matched)
+	report.Pass, report.Expected = checkCount(report.Count, v)
+	if !report.Pass {
+		sort.SliceStable(nearMisses, func(i, j int) bool {
+			return nearMisses[i].Score > nearMisses[j].Score
+		})
+		if len(nearMisses) > verifyNearMisses {
+			nearMisses = nearMisses[:verifyNearMisses]
+		}
+		report.NearMisses = nearMisses
+	}
+
+	jsonResponse(http.StatusOK, report, w)
+}
+
+// checkCount checks count against the expected counts of a verification, and describes what's expected
+func checkCount(count int, v verification) (bool, string) {
+	switch {
+	case v.Exactly != nil:
+		return count == *v.Exactly, fmt.Sprintf("exactly %d", *v.Exactly)
+
+	case v.AtLeast != nil && v.AtMost != nil:
+		return count >= *v.AtLeast && count <= *v.AtMost, fmt.Sprintf("at least %d and at most %d", *v.AtLeast, *v.AtMost)
+
+	case v.AtMost != nil:
+		return count <= *v.AtMost, fmt.Sprintf("at most %d", *v.AtMost)
+
+	case v.AtLeast != nil:
+		return count >= *v.AtLeast, fmt.Sprintf("at least %d", *v.AtLeast)
+
+	default:
+		return count >= 1, "at least 1"
+	}
+}
+
+// entryRequest recreates a request recorded in the journal, with its already read body
+func entryRequest(entry *journal.Entry) (*http.Request, *rules.RequestBody, error) {
+	request, err := http.NewRequest(entry.Method, entry.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Header = entry.Headers
+
+	return request, rules.NewRequestBody([]byte(entry.Body), entry.Headers.Get("Content-Type")), nil
+}
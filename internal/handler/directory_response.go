@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/render"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// writeDirectoryResponse serves a file under the response's directory, by the part of request path matched by '**'.
+// Paths escaping the directory, including via symlinks, are rejected.
+func writeDirectoryResponse(rule *rules.CompiledRule, response *rules.CompiledResponseRule, status int, data render.Data, w http.ResponseWriter, r *http.Request) {
+	remainder := rule.PathRemainder(r.URL.Path)
+	for _, segment := range strings.Split(remainder, "/") {
+		if segment == ".." || strings.ContainsRune(segment, '\\') {
+			errorResponse(http.StatusForbidden, fmt.Sprintf("invalid path: %s", r.URL.Path), w)
+			return
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(resolvePath(rule.Dir, response.Directory))
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to find directory, err: %s", err.Error()), w)
+		return
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to find directory, err: %s", err.Error()), w)
+		return
+	}
+
+	target, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(remainder)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			errorResponse(http.StatusNotFound, fmt.Sprintf("file not found: %s", r.URL.Path), w)
+		} else {
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to find file, err: %s", err.Error()), w)
+		}
+		return
+	}
+	if target != root && !strings.HasPrefix(target, root+string(filepath.Separator)) {
+		errorResponse(http.StatusForbidden, fmt.Sprintf("invalid path: %s", r.URL.Path), w)
+		return
+	}
+
+	stat, err := os.Stat(target)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to find file, err: %s", err.Error()), w)
+		return
+	}
+
+	if !stat.IsDir() {
+		writeFileResponse(rule, response, target, status, data, w, r)
+		return
+	}
+
+	// redirect so relative links in index files and listings work
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	index := response.Index
+	if index == "" {
+		index = "index.html"
+	}
+	indexPath := filepath.Join(target, index)
+	if indexStat, err := os.Stat(indexPath); err == nil && !indexStat.IsDir() {
+		writeFileResponse(rule, response, indexPath, status, data, w, r)
+		return
+	}
+
+	if !response.Listing {
+		errorResponse(http.StatusNotFound, fmt.Sprintf("file not found: %s", r.URL.Path), w)
+		return
+	}
+
+	writeDirectoryListing(target, w, r)
+}
+
+func writeDirectoryListing(dir string, w http.ResponseWriter, r *http.Request) {
+	log.Printf("Creating directory listing of: %s", dir)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to read directory, err: %s", err.Error()), w)
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString("<!DOCTYPE html>\n<html>\n<body>\n<pre>\n")
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&builder, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(name))
+	}
+	builder.WriteString("</pre>\n</body>\n</html>\n")
+
+	setDefaultContentType(w, "text/html; charset=utf-8")
+	w.Write([]byte(builder.String()))
+}
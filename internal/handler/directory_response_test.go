@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+func TestDirectoryResponse(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"secret.txt":             "secret",
+		"public/index.html":      "<p>index</p>",
+		"public/css/site.css":    "body {}",
+		"public/docs/readme.txt": "readme",
+	})
+	public := filepath.Join(dir, "public")
+	err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(public, "escape.txt"))
+	if err == nil {
+		err = os.Symlink(filepath.Join(public, "css", "site.css"), filepath.Join(public, "site.css"))
+	}
+	if err != nil {
+		t.Skipf("symlinks aren't supported, err: %s", err)
+	}
+
+	h := newTestHandler(t, config.ServerConfig{},
+		config.Rule{
+			Request:  config.RequestRule{Method: "GET", Path: "/^assets$/**"},
+			Response: config.ResponseRule{Directory: "public"},
+			Dir:      dir,
+		},
+		config.Rule{
+			Request:  config.RequestRule{Method: "GET", Path: "/^listing$/**"},
+			Response: config.ResponseRule{Directory: "public", Listing: true},
+			Dir:      dir,
+		},
+	)
+
+	tests := []struct {
+		path     string
+		expected int
+		body     string
+	}{
+		{"/assets/", http.StatusOK, "<p>index</p>"},
+		{"/assets", http.StatusMovedPermanently, ""},
+		{"/assets/css/site.css", http.StatusOK, "body {}"},
+		{"/assets/site.css", http.StatusOK, "body {}"},
+		{"/assets/docs/", http.StatusNotFound, ""},
+		{"/assets/nothing.txt", http.StatusNotFound, ""},
+		{"/assets/../secret.txt", http.StatusForbidden, ""},
+		{"/assets/css/../../secret.txt", http.StatusForbidden, ""},
+		{"/assets/%2e%2e/secret.txt", http.StatusForbidden, ""},
+		{"/assets/..%5csecret.txt", http.StatusForbidden, ""},
+		{"/assets/escape.txt", http.StatusForbidden, ""},
+		{"/listing/docs/", http.StatusOK, `<a href="readme.txt">readme.txt</a>`},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d %q", test.path, test.expected, w.Code, w.Body.String())
+			continue
+		}
+		if !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("%s: expected body containing %q, got %q", test.path, test.body, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "secret") && !strings.Contains(w.Body.String(), "invalid path") {
+			t.Errorf("%s: leaked a file outside the directory: %q", test.path, w.Body.String())
+		}
+	}
+}
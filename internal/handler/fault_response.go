@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/fault"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// bufferedResponse is a http.ResponseWriter which keeps the response in memory,
+// so it can be written to the connection in a broken way.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{
+		header: make(http.Header),
+	}
+}
+
+func (br *bufferedResponse) Header() http.Header {
+	return br.header
+}
+
+func (br *bufferedResponse) Write(b []byte) (int, error) {
+	if br.status == 0 {
+		br.status = http.StatusOK
+	}
+	return br.body.Write(b)
+}
+
+func (br *bufferedResponse) WriteHeader(status int) {
+	if br.status == 0 {
+		br.status = status
+	}
+}
+
+// writeFaultResponse writes the response, broken as described by the response's fault
+func writeFaultResponse(rule *rules.CompiledRule, response *rules.CompiledResponseRule, variables map[string]*rules.Variable, w http.ResponseWriter, r *http.Request) {
+	f := response.Fault
+	log.Printf("Injecting fault '%s' into response", f.Type)
+
+	br := newBufferedResponse()
+	if f.Type != fault.Close && f.Type != fault.Reset {
+		writeResponse(rule, response, variables, br, r)
+		if br.status == 0 {
+			br.status = http.StatusOK
+		}
+	}
+
+	switch f.Type {
+	case fault.Close, fault.Reset:
+		conn, _, err := hijack(w)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, err.Error(), w)
+			return
+		}
+		if f.Type == fault.Reset {
+			resetConn(conn)
+		}
+		conn.Close()
+
+	case fault.Hang:
+		copyHeader(w.Header(), br.header)
+		w.Header().Set("Content-Length", strconv.Itoa(br.body.Len()))
+		w.WriteHeader(br.status)
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		<-r.Context().Done()
+
+	case fault.Truncate:
+		conn, bufrw, err := hijack(w)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, err.Error(), w)
+			return
+		}
+		defer conn.Close()
+
+		body := br.body.Bytes()
+		br.header.Set("Content-Length", strconv.Itoa(len(body)))
+		if f.After < int64(len(body)) {
+			body = body[:f.After]
+		}
+		writeRawResponse(bufrw, fmt.Sprintf("HTTP/1.1 %03d %s", br.status, http.StatusText(br.status)), br.header, body)
+
+	case fault.Throttle:
+		copyHeader(w.Header(), br.header)
+		w.Header().Set("Content-Length", strconv.Itoa(br.body.Len()))
+		w.WriteHeader(br.status)
+		throttle(w, r, br.body.Bytes(), f.BytesPerSecond)
+
+	case fault.Malformed:
+		conn, bufrw, err := hijack(w)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, err.Error(), w)
+			return
+		}
+		defer conn.Close()
+
+		br.header.Set("Content-Length", strconv.Itoa(br.body.Len()))
+		writeRawResponse(bufrw, f.StatusLine, br.header, br.body.Bytes())
+	}
+}
+
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection doesn't support hijacking, fault can't be injected")
+	}
+	return hijacker.Hijack()
+}
+
+// resetConn makes closing the connection send a TCP RST instead of a FIN
+func resetConn(conn net.Conn) {
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+}
+
+func copyHeader(dst http.Header, src http.Header) {
+	for k, values := range src {
+		for _, v := range values {
+			dst.Add(k, v)
+		}
+	}
+}
+
+func writeRawResponse(bufrw *bufio.ReadWriter, statusLine string, header http.Header, body []byte) {
+	bufrw.WriteString(statusLine + "\r\n")
+	header.Write(bufrw)
+	bufrw.WriteString("\r\n")
+	bufrw.Write(body)
+	bufrw.Flush()
+}
+
+// throttle writes body in chunks every 100ms, so at most bytesPerSecond bytes are written every second
+func throttle(w http.ResponseWriter, r *http.Request, body []byte, bytesPerSecond int64) {
+	const interval = 100 * time.Millisecond
+	chunkSize := int(bytesPerSecond / int64(time.Second/interval))
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	wait := time.Duration(int64(chunkSize) * int64(time.Second) / bytesPerSecond)
+
+	flusher, _ := w.(http.Flusher)
+	for len(body) > 0 {
+		n := chunkSize
+		if n > len(body) {
+			n = len(body)
+		}
+		_, err := w.Write(body[:n])
+		if err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		body = body[n:]
+
+		if len(body) > 0 {
+			select {
+			case <-time.After(wait):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
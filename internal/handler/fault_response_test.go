@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+func faultRule(path string, f config.FaultRule) config.Rule {
+	return config.Rule{
+		Name:     path,
+		Request:  config.RequestRule{Method: "GET", Path: "/^" + path + "$"},
+		Response: config.ResponseRule{BodyRaw: "0123456789", Fault: &f},
+	}
+}
+
+// rawGet sends a GET request over a new connection, and returns what's read until the connection ends
+func rawGet(t *testing.T, server *httptest.Server, path string) (string, error) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("GET " + path + " HTTP/1.1\r\nHost: test\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ioutil.ReadAll(bufio.NewReader(conn))
+	return string(read), err
+}
+
+func TestFaultResponse(t *testing.T) {
+	never := 0.0
+	h := newTestHandler(t, config.ServerConfig{},
+		faultRule("close", config.FaultRule{Type: "close"}),
+		faultRule("reset", config.FaultRule{Type: "reset"}),
+		faultRule("hang", config.FaultRule{Type: "hang"}),
+		faultRule("truncate", config.FaultRule{Type: "truncate", After: 3}),
+		faultRule("throttle", config.FaultRule{Type: "throttle", BytesPerSecond: 20}),
+		faultRule("malformed", config.FaultRule{Type: "malformed"}),
+		faultRule("never", config.FaultRule{Type: "close", Probability: &never}),
+	)
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	t.Run("close", func(t *testing.T) {
+		read, err := rawGet(t, server, "/close")
+		if err != nil || read != "" {
+			t.Errorf("expected the connection to be closed without a response, got %q %v", read, err)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		read, err := rawGet(t, server, "/reset")
+		if !errors.Is(err, syscall.ECONNRESET) || read != "" {
+			t.Errorf("expected the connection to be reset, got %q %v", read, err)
+		}
+	})
+
+	t.Run("hang", func(t *testing.T) {
+		client := &http.Client{Timeout: 300 * time.Millisecond}
+		resp, err := client.Get(server.URL + "/hang")
+		if err != nil {
+			t.Fatalf("expected status and headers before hanging, err: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.ContentLength != 10 {
+			t.Errorf("expected 200 with Content-Length 10, got %d %d", resp.StatusCode, resp.ContentLength)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err == nil || len(body) != 0 {
+			t.Errorf("expected reading the body to time out, got %q %v", body, err)
+		}
+	})
+
+	t.Run("truncate", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/truncate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != io.ErrUnexpectedEOF || string(body) != "012" || resp.ContentLength != 10 {
+			t.Errorf("expected 3 of 10 bytes and an unexpected EOF, got %q of %d bytes, err: %v", body, resp.ContentLength, err)
+		}
+	})
+
+	t.Run("throttle", func(t *testing.T) {
+		start := time.Now()
+		resp, err := http.Get(server.URL + "/throttle")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		elapsed := time.Since(start)
+		if err != nil || string(body) != "0123456789" {
+			t.Errorf("expected the whole body, got %q %v", body, err)
+		}
+		// 2 bytes every 100ms
+		if elapsed < 350*time.Millisecond {
+			t.Errorf("expected 10 bytes at 20 bytes per second to take about 400ms, took %s", elapsed)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		read, _ := rawGet(t, server, "/malformed")
+		if !strings.HasPrefix(read, "HTTP/1.1 ??? Malformed\r\n") || !strings.HasSuffix(read, "\r\n\r\n0123456789") {
+			t.Errorf("expected the malformed status line and the body, got %q", read)
+		}
+
+		_, err := http.Get(server.URL + "/malformed")
+		if err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Errorf("expected clients to fail parsing the response, got %v", err)
+		}
+	})
+
+	t.Run("probability", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/never")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "0123456789" {
+			t.Errorf("expected a normal response, got %d %q", resp.StatusCode, body)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/imafish/http-test-server/internal/render"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// writeFileResponse writes contents of a file, with Range and conditional requests supported unless the response has a non-200 status.
+func writeFileResponse(rule *rules.CompiledRule, response *rules.CompiledResponseRule, filePath string, status int, data render.Data, w http.ResponseWriter, r *http.Request) {
+	filePath = resolvePath(rule.Dir, filePath)
+	log.Printf("Creating file response using: %s", filePath)
+
+	inFile, err := os.Open(filePath)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to open file, err: %s", err), w)
+		return
+	}
+	defer inFile.Close()
+
+	stat, err := inFile.Stat()
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to find file, err: %s", err.Error()), w)
+		return
+	}
+	if stat.IsDir() {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("%s is a directory", filePath), w)
+		return
+	}
+
+	var content io.ReadSeeker = inFile
+	size := stat.Size()
+	etag := fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), size)
+	if response.RenderFile {
+		raw, err := ioutil.ReadAll(inFile)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to read file, err: %s", err.Error()), w)
+			return
+		}
+		rendered, err := render.RenderText(string(raw), data)
+		if err != nil {
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to render file, err: %s", err.Error()), w)
+			return
+		}
+		content = bytes.NewReader([]byte(rendered))
+		size = int64(len(rendered))
+		etag = fmt.Sprintf(`"%x"`, sha1.Sum([]byte(rendered)))
+	}
+
+	filename := filepath.Base(filePath)
+	if response.Disposition != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", response.Disposition, filename))
+	}
+
+	if status != 0 && status != http.StatusOK {
+		// a custom status can't be combined with partial or conditional responses
+		setDefaultContentType(w, contentType(filename, content))
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(status)
+		io.Copy(w, content)
+		return
+	}
+
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, filename, stat.ModTime(), content)
+}
+
+// resolvePath resolves a relative path against dir
+func resolvePath(dir string, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// contentType detects MIME type of content from the file extension, or by sniffing the first 512 bytes.
+func contentType(filename string, content io.ReadSeeker) string {
+	ctype := mime.TypeByExtension(filepath.Ext(filename))
+	if ctype != "" {
+		return ctype
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(content, buf)
+	content.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
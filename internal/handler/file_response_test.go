@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// tempDir creates a directory removed when the test completes, with files of the given contents
+func tempDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "handler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(path, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFileResponse(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"book.txt":  "0123456789",
+		"greet.txt": "hello {{id}}",
+	})
+	h := newTestHandler(t, config.ServerConfig{},
+		config.Rule{
+			Request:  config.RequestRule{Method: "GET", Path: "/book"},
+			Response: config.ResponseRule{File: "book.txt", Disposition: "attachment"},
+			Dir:      dir,
+		},
+		config.Rule{
+			Request:  config.RequestRule{Method: "GET", Path: "/greet/{id:int}"},
+			Response: config.ResponseRule{File: "greet.txt", RenderFile: true},
+			Dir:      dir,
+		},
+		config.Rule{
+			Request:  config.RequestRule{Method: "GET", Path: "/missing"},
+			Response: config.ResponseRule{Status: "404", File: "book.txt"},
+			Dir:      dir,
+		},
+	)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/book", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Fatalf("expected the whole file, got %d %q", w.Code, w.Body.String())
+	}
+	if ctype := w.Header().Get("Content-Type"); ctype != "text/plain; charset=utf-8" {
+		t.Errorf("expected Content-Type detected from the extension, got %s", ctype)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename="book.txt"` {
+		t.Errorf("unexpected Content-Disposition %s", disposition)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected an ETag")
+	}
+
+	t.Run("range", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/book", nil)
+		r.Header.Set("Range", "bytes=2-5")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+			t.Errorf("expected 206 %q, got %d %q", "2345", w.Code, w.Body.String())
+		}
+		if contentRange := w.Header().Get("Content-Range"); contentRange != "bytes 2-5/10" {
+			t.Errorf("unexpected Content-Range %s", contentRange)
+		}
+	})
+
+	t.Run("unsatisfiable range", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/book", nil)
+		r.Header.Set("Range", "bytes=20-30")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("expected 416, got %d", w.Code)
+		}
+	})
+
+	t.Run("if-none-match", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/book", nil)
+		r.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("expected 304 without a body, got %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("render file", func(t *testing.T) {
+		etags := make(map[string]bool)
+		for _, id := range []string{"7", "8"} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/greet/"+id, nil))
+			if w.Code != http.StatusOK || w.Body.String() != "hello "+id {
+				t.Errorf("expected the rendered file, got %d %q", w.Code, w.Body.String())
+			}
+			etags[w.Header().Get("ETag")] = true
+		}
+		if len(etags) != 2 {
+			t.Errorf("expected ETags of rendered files to differ, got %v", etags)
+		}
+	})
+
+	t.Run("custom status", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/missing", nil)
+		r.Header.Set("Range", "bytes=2-5")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound || w.Body.String() != "0123456789" {
+			t.Errorf("expected the whole file with status 404, got %d %q", w.Code, w.Body.String())
+		}
+	})
+}
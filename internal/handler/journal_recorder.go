@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/journal"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// statusRecorder records the status code written to a response, for the journal
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(statusCode int) {
+	if sr.status == 0 {
+		sr.status = statusCode
+	}
+	sr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection doesn't support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// addJournalEntry adds a served request into the journal of the handler
+func (rh *RequestHandler) addJournalEntry(start time.Time, r *http.Request, body []byte, rule *rules.CompiledRule, variables map[string]*rules.Variable, status int) {
+	entry := journal.Entry{
+		Time:      start,
+		Server:    rh.Server.Addr,
+		Method:    r.Method,
+		URL:       r.RequestURI,
+		Path:      r.URL.Path,
+		Headers:   r.Header,
+		Body:      string(body),
+		Status:    status,
+		LatencyMS: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if rule != nil {
+		entry.Rule = rule.Name
+		entry.Variables, _ = templateData(variables)
+	}
+
+	rh.Journal.Add(entry)
+}
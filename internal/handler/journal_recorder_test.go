@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/journal"
+)
+
+// hijackableRecorder is a ResponseRecorder which can be hijacked
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (hr *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hr.hijacked = true
+	return nil, nil, nil
+}
+
+func TestStatusRecorderKeepsInterfaces(t *testing.T) {
+	w := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	var recorder http.ResponseWriter = &statusRecorder{ResponseWriter: w}
+
+	flusher, ok := recorder.(http.Flusher)
+	if !ok {
+		t.Fatalf("expected statusRecorder to be a Flusher")
+	}
+	flusher.Flush()
+	if !w.Flushed {
+		t.Errorf("expected Flush to flush the wrapped writer")
+	}
+
+	hijacker, ok := recorder.(http.Hijacker)
+	if !ok {
+		t.Fatalf("expected statusRecorder to be a Hijacker")
+	}
+	_, _, err := hijacker.Hijack()
+	if err != nil || !w.hijacked {
+		t.Errorf("expected Hijack to hijack the wrapped writer, err: %v", err)
+	}
+
+	_, _, err = (&statusRecorder{ResponseWriter: httptest.NewRecorder()}).Hijack()
+	if err == nil {
+		t.Errorf("expected an error hijacking a writer which can't be hijacked")
+	}
+}
+
+func TestStatusRecorderRecordsFirstStatus(t *testing.T) {
+	recorder := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	recorder.Write([]byte("body"))
+	recorder.WriteHeader(http.StatusNotFound)
+	if recorder.status != http.StatusOK {
+		t.Errorf("expected an implicit 200 to be recorded by Write, got %d", recorder.status)
+	}
+
+	recorder = &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	recorder.WriteHeader(http.StatusCreated)
+	recorder.Write([]byte("body"))
+	if recorder.status != http.StatusCreated {
+		t.Errorf("expected 201, got %d", recorder.status)
+	}
+}
+
+func TestJournalFaultedResponses(t *testing.T) {
+	h := newTestHandler(t, config.ServerConfig{},
+		faultRule("close", config.FaultRule{Type: "close"}),
+		faultRule("throttle", config.FaultRule{Type: "throttle", BytesPerSecond: 1000}),
+	)
+	h.Journal = journal.New(10)
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	rawGet(t, server, "/close")
+	resp, err := http.Get(server.URL + "/throttle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	entries := h.Journal.Entries(journal.Filter{})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Rule != "close" || entries[0].Status != 0 {
+		t.Errorf("expected the closed connection to be journaled without status, got rule '%s' status %d", entries[0].Rule, entries[0].Status)
+	}
+	if entries[1].Rule != "throttle" || entries[1].Status != http.StatusOK {
+		t.Errorf("expected the throttled response to be journaled with status 200, got rule '%s' status %d", entries[1].Rule, entries[1].Status)
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// ReloadStatus records results of loading rules, it's safe for concurrent use
+type ReloadStatus struct {
+	mtx    sync.Mutex
+	report reloadReport
+}
+
+type reloadReport struct {
+	Loads         int        `json:"loads"` // successful loads, including the initial one
+	Failures      int        `json:"failures"`
+	Rules         int        `json:"rules"` // number of rules of the last successful load
+	LastSuccess   time.Time  `json:"last_success"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// Succeeded records a successful load of ruleCount rules
+func (rs *ReloadStatus) Succeeded(ruleCount int) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	rs.report.Loads++
+	rs.report.Rules = ruleCount
+	rs.report.LastSuccess = time.Now()
+	log.Printf("rules loaded, %d rules, %d loads, %d failures", ruleCount, rs.report.Loads, rs.report.Failures)
+}
+
+// Failed records a failed load of rules or servers, whatever failed to load is kept as it was
+func (rs *ReloadStatus) Failed(err error) {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+
+	now := time.Now()
+	rs.report.Failures++
+	rs.report.LastError = err.Error()
+	rs.report.LastErrorTime = &now
+	log.Printf("Failed to reload config, %d failures, err: %s", rs.report.Failures, err.Error())
+}
+
+func (rs *ReloadStatus) snapshot() reloadReport {
+	rs.mtx.Lock()
+	defer rs.mtx.Unlock()
+	return rs.report
+}
@@ -1,62 +1,146 @@
 package handler
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
-	"sync"
+	"time"
 
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/delay"
+	"github.com/imafish/http-test-server/internal/journal"
+	"github.com/imafish/http-test-server/internal/proxy"
+	"github.com/imafish/http-test-server/internal/render"
 	"github.com/imafish/http-test-server/internal/rules"
 )
 
-// RequestHandler handles incoming requests
+// RequestHandler handles incoming requests of a server
 type RequestHandler struct {
-	Rules *[]*rules.CompiledRule
-	Mtx   *sync.Mutex
+	Rules   *rules.AtomicRuleSet
+	Server  config.ServerConfig
+	Delay   delay.Delay      // default delay of the server, compiled from Server.Delay
+	Admin   http.Handler     // handles requests to AdminPathPrefix, nil disables admin endpoints
+	Proxy   *proxy.Recorder  // forwards and records requests no rule matches, nil if not in record mode
+	Journal *journal.Journal // records served requests, nil disables the journal
 }
 
 func (rh *RequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("\n------- ------- -------")
 	log.Printf("Incoming request: %s", r.RequestURI)
-	bodyBytes, _ := ioutil.ReadAll(r.Body)
+
+	if rh.Admin != nil && strings.HasPrefix(r.URL.Path, AdminPathPrefix) {
+		rh.Admin.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+	var bodyBytes []byte
+	var rule *rules.CompiledRule
+	var variables map[string]*rules.Variable
+	if rh.Journal != nil {
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			rh.addJournalEntry(start, r, bodyBytes, rule, variables, recorder.status)
+		}()
+	}
+
+	maxBodySize := rh.Server.MaxBodySize
+	if maxBodySize > 0 {
+		if r.ContentLength > maxBodySize {
+			errorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxBodySize), w)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(r.Body)
 	r.Body.Close()
-	r.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		if maxBodySize > 0 && int64(len(bodyBytes)) >= maxBodySize {
+			errorResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxBodySize), w)
+		} else {
+			errorResponse(http.StatusBadRequest, fmt.Sprintf("Failed to read request body, err: %s", err.Error()), w)
+		}
+		return
+	}
 	log.Printf("Incoming request body: %s", string(bodyBytes))
+	body := rules.NewRequestBody(bodyBytes, r.Header.Get("Content-Type"))
 
-	rh.Mtx.Lock()
-	defer rh.Mtx.Unlock()
+	// the request is matched and responded by the snapshot of rules loaded here, even if rules are changed meanwhile
+	ruleSet := rh.Rules.Load()
+	var nearMisses []*rules.NearMiss
+	rule, variables, err = rules.FindMatchingRule(ruleSet, r, body)
+	if err == nil && rule == nil && rh.Proxy == nil && rh.Server.NearMisses > 0 {
+		nearMisses = rules.FindNearMisses(ruleSet, r, body, rh.Server.NearMisses)
+	}
 
-	rule, variables, err := rules.FindMatchingRule(rh.Rules, r)
 	if err != nil {
 		errorResponse(http.StatusInternalServerError, fmt.Sprintf("error in finding matching rule for this request, err: %s", err.Error()), w)
 		return
 	}
 	if rule == nil {
-		errorResponse(http.StatusNotFound, "no matching rule found for this request", w)
+		if rh.Proxy != nil {
+			rh.Proxy.Forward(w, r, body)
+		} else if rh.Server.NearMisses > 0 {
+			nearMissResponse(nearMisses, w)
+		} else {
+			errorResponse(http.StatusNotFound, "no matching rule found for this request", w)
+		}
 	} else {
 		log.Printf("Found rule '%s'", rule.Name)
-		writeResponse(rule, variables, w)
+
+		if rule.Resource != nil {
+			delay.Sleep(r.Context(), rh.Delay)
+			writeResourceResponse(rule, body, w, r)
+			return
+		}
+
+		response := rule.NextResponse()
+
+		responseDelay := response.Delay
+		if responseDelay == nil {
+			responseDelay = rh.Delay
+		}
+		delay.Sleep(r.Context(), responseDelay)
+
+		if response.Fault != nil && response.Fault.Triggered() {
+			writeFaultResponse(rule, response, variables, w, r)
+		} else {
+			writeResponse(rule, response, variables, w, r)
+		}
 	}
 }
 
-func writeResponse(rule *rules.CompiledRule, variables map[string]*rules.Variable, w http.ResponseWriter) {
-	responseRule := rule.Response
+func writeResponse(rule *rules.CompiledRule, response *rules.CompiledResponseRule, variables map[string]*rules.Variable, w http.ResponseWriter, r *http.Request) {
+	responseTemplate := response.Template
+
+	data, err := templateData(variables)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to read variables, err: %s", err.Error()), w)
+		return
+	}
+
+	status, err := responseTemplate.Status(data)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to render status code, err: %s", err.Error()), w)
+		return
+	}
 
 	// headers
-	for _, header := range responseRule.Headers {
-		splits := strings.Split(header, ":")
+	headers, err := responseTemplate.Headers(data)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to render headers, err: %s", err.Error()), w)
+		return
+	}
+	for _, header := range headers {
+		splits := strings.SplitN(header, ":", 2)
 		if len(splits) != 2 {
-			errorResponse(http.StatusInternalServerError, fmt.Sprintf("header string should contain exact 1 colon, actual: %s", header), w)
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("header string should contain a colon, actual: %s", header), w)
 			return
 		}
 		headerKey := strings.TrimSpace(splits[0])
@@ -65,125 +149,114 @@ func writeResponse(rule *rules.CompiledRule, variables map[string]*rules.Variabl
 	}
 
 	// body
-	filePath := responseRule.File
-	objBody := responseRule.Body
+	filePath, err := responseTemplate.File(data)
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to render file path, err: %s", err.Error()), w)
+		return
+	}
 	if filePath != "" {
-		log.Printf("Creating file response using: %s", filePath)
-		stat, err := os.Stat(filePath)
+		writeFileResponse(rule, response, filePath, status, data, w, r)
+
+	} else if response.Directory != "" {
+		writeDirectoryResponse(rule, response, status, data, w, r)
+
+	} else if responseTemplate.HasBody() {
+		log.Printf("Creating response body using object")
+		jsonObj, err := responseTemplate.Body(data)
 		if err != nil {
-			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to find file, err: %s", err.Error()), w)
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to render body object, err: %s", err.Error()), w)
 			return
 		}
-
-		inFile, err := os.Open(filePath)
+		bytes, err := json.Marshal(jsonObj)
 		if err != nil {
-			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to open file, err: %s", err), w)
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal obj into json, err: %s", err.Error()), w)
 			return
 		}
-		defer inFile.Close()
 
 		// set headers and status code before write to body
-		filename := filepath.Base(filePath)
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-		w.Header().Set("Content-Length", strconv.FormatInt(stat.Size(), 10))
-		if responseRule.Status != 0 {
-			w.WriteHeader(responseRule.Status)
+		setDefaultContentType(w, "application/json")
+		if status != 0 {
+			w.WriteHeader(status)
 		}
 
-		buf := make([]byte, 1024)
-		for {
-			n, err := inFile.Read(buf)
-			if err != nil && err != io.EOF {
-				errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to read file, err: %s", err.Error()), w)
-				return
-			}
-			if n == 0 || err == io.EOF {
-				break
-			}
-			w.Write(buf[:n])
-		}
+		w.Write(bytes)
 
-	} else if objBody != nil {
-		log.Printf("Creating response body using object")
-		jsonObj, err := convertToJSON(objBody, variables)
+	} else if responseTemplate.HasRawBody() {
+		log.Printf("Creating raw response body")
+		bytes, err := responseTemplate.RawBody(data)
 		if err != nil {
-			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to convert YAML object to JSON object, err: %s", err.Error()), w)
-		}
-		bytes, err := json.Marshal(jsonObj)
-		if err != nil {
-			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal obj into json, err: %s", err.Error()), w)
+			errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to render raw body, err: %s", err.Error()), w)
 			return
 		}
 
-		// set status code before write to body
-		if responseRule.Status != 0 {
-			w.WriteHeader(responseRule.Status)
+		// set headers and status code before write to body
+		setDefaultContentType(w, http.DetectContentType(bytes))
+		if status != 0 {
+			w.WriteHeader(status)
 		}
 
 		w.Write(bytes)
+
+	} else if status != 0 {
+		w.WriteHeader(status)
 	}
 }
 
-func convertToJSON(objBody interface{}, variables map[string]*rules.Variable) (interface{}, error) {
-
-	switch b := objBody.(type) {
-	case map[interface{}]interface{}:
-		result := make(map[string]interface{})
-		for k, v := range b {
-			keyString, ok := k.(string)
-			if !ok {
-				return nil, fmt.Errorf("key of map object must of string ")
-			}
-
-			vConverted, err := convertToJSON(v, variables)
-			if err != nil {
-				return nil, err
-			}
-			result[keyString] = vConverted
-		}
-		return result, nil
-
-	case []interface{}:
-		result := make([]interface{}, 0, len(b))
-		for _, v := range b {
-			vConverted, err := convertToJSON(v, variables)
-			if err != nil {
-				return nil, err
-			}
-			result = append(result, vConverted)
-		}
-		return result, nil
-
-	case string:
-		regex := regexp.MustCompile(`^{{(\w+)}}$`)
-		matches := regex.FindStringSubmatch(b)
-		if matches != nil {
-			// single match
-			v := variables[matches[1]]
-			if v == nil {
-				return nil, nil
-			}
-			return v.GetValue()
-		}
+// setDefaultContentType sets Content-Type header if it's not set by the rule
+func setDefaultContentType(w http.ResponseWriter, contentType string) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+}
 
-		for k, v := range variables {
-			regex, err := regexp.Compile("{{" + k + "}}")
-			if err != nil {
-				return nil, err
-			}
-
-			value, err := v.GetValue()
-			if err != nil {
-				return nil, err
-			}
-			b = regex.ReplaceAllString(b, fmt.Sprint(value))
+// templateData converts captured variables into data for response templates
+func templateData(variables map[string]*rules.Variable) (render.Data, error) {
+	data := make(render.Data, len(variables))
+	for k, v := range variables {
+		value, err := v.GetValue()
+		if err != nil {
+			return nil, err
 		}
+		data[k] = value
+	}
+	return data, nil
+}
 
-		return b, nil
+type nearMissReport struct {
+	Rule       string   `json:"rule"`
+	Index      int      `json:"index"`
+	Score      int      `json:"score"`
+	Mismatches []string `json:"mismatches"`
+}
 
-	default:
-		return b, nil
+// nearMissResponse responses 404 status code, and body as a JSON report of rules closest to matching the request
+func nearMissResponse(nearMisses []*rules.NearMiss, w http.ResponseWriter) {
+	errorMsg := "no matching rule found for this request"
+	log.Println(errorMsg)
+
+	reports := make([]nearMissReport, len(nearMisses))
+	for i, nm := range nearMisses {
+		log.Printf("Near miss #%d: rule %d '%s', score %d, mismatches: %s", i+1, nm.Index, nm.Rule.Name, nm.Score, strings.Join(nm.Mismatches, "; "))
+		reports[i] = nearMissReport{
+			Rule:       nm.Rule.Name,
+			Index:      nm.Index,
+			Score:      nm.Score,
+			Mismatches: nm.Mismatches,
+		}
+	}
+
+	bytes, err := json.Marshal(map[string]interface{}{
+		"error":       errorMsg,
+		"near_misses": reports,
+	})
+	if err != nil {
+		errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to marshal near misses into json, err: %s", err.Error()), w)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(bytes)
 }
 
 // errorResponse reponses 500 status code, and body as errorMsg
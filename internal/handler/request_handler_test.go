@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// newTestHandler creates a handler of a server serving rules
+func newTestHandler(t *testing.T, server config.ServerConfig, configRules ...config.Rule) *RequestHandler {
+	t.Helper()
+
+	compiledRules := make([]*rules.CompiledRule, len(configRules))
+	for i, r := range configRules {
+		compiled, err := rules.CompileRule(r)
+		if err != nil {
+			t.Fatalf("failed to compile rule %s: %s", r.Name, err)
+		}
+		compiledRules[i] = compiled
+	}
+
+	return &RequestHandler{
+		Rules:  rules.NewAtomicRuleSet(rules.NewRuleSet(compiledRules)),
+		Server: server,
+	}
+}
+
+// chunkedReader hides the length of a body, so the request has no Content-Length
+type chunkedReader struct {
+	io.Reader
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := newTestHandler(t, config.ServerConfig{MaxBodySize: 8}, config.Rule{
+		Request:  config.RequestRule{Method: "POST", Path: "/upload"},
+		Response: config.ResponseRule{Status: "200"},
+	})
+
+	tests := []struct {
+		name     string
+		body     io.Reader
+		expected int
+	}{
+		{"at the limit", strings.NewReader("12345678"), http.StatusOK},
+		{"declared larger", strings.NewReader("123456789"), http.StatusRequestEntityTooLarge},
+		{"chunked larger", chunkedReader{strings.NewReader("123456789")}, http.StatusRequestEntityTooLarge},
+		{"chunked at the limit", chunkedReader{strings.NewReader("12345678")}, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/upload", test.body)
+		if _, ok := test.body.(chunkedReader); ok && r.ContentLength != -1 {
+			t.Fatalf("%s: expected a request without Content-Length, got %d", test.name, r.ContentLength)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.expected {
+			t.Errorf("%s: expected status %d, got %d %s", test.name, test.expected, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/resource"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// writeResourceResponse serves a request to the collection of a resource rule.
+// The collection path supports GET (list, with 'page', 'size' and field filters in query) and POST (create),
+// the item path supports GET, PUT, PATCH and DELETE.
+func writeResourceResponse(rule *rules.CompiledRule, body *rules.RequestBody, w http.ResponseWriter, r *http.Request) {
+	store := rule.Resource
+	id := rule.PathRemainder(r.URL.Path)
+	log.Printf("Creating resource response, id: '%s'", id)
+
+	if strings.Contains(id, "/") {
+		errorResponse(http.StatusNotFound, fmt.Sprintf("resource not found: %s", r.URL.Path), w)
+		return
+	}
+
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listResource(store, w, r)
+
+		case http.MethodPost:
+			item, ok := resourceItem(body, w)
+			if !ok {
+				return
+			}
+			created, ok, err := store.Create(item)
+			if err != nil {
+				errorResponse(http.StatusInternalServerError, fmt.Sprintf("Failed to create item, err: %s", err.Error()), w)
+				return
+			}
+			if !ok {
+				errorResponse(http.StatusConflict, fmt.Sprintf("item with %s %v exists", store.IDField(), item[store.IDField()]), w)
+				return
+			}
+			w.Header().Set("Location", path.Join(r.URL.Path, resource.IDString(created[store.IDField()])))
+			jsonResponse(http.StatusCreated, created, w)
+
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			errorResponse(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed on %s", r.Method, r.URL.Path), w)
+		}
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		item, ok := store.Get(id)
+		if !ok {
+			errorResponse(http.StatusNotFound, fmt.Sprintf("resource not found: %s", r.URL.Path), w)
+			return
+		}
+		jsonResponse(http.StatusOK, item, w)
+
+	case http.MethodPut, http.MethodPatch:
+		item, ok := resourceItem(body, w)
+		if !ok {
+			return
+		}
+
+		var updated resource.Item
+		if r.Method == http.MethodPut {
+			updated, ok = store.Replace(id, item)
+		} else {
+			updated, ok = store.Patch(id, item)
+		}
+		if !ok {
+			errorResponse(http.StatusNotFound, fmt.Sprintf("resource not found: %s", r.URL.Path), w)
+			return
+		}
+		jsonResponse(http.StatusOK, updated, w)
+
+	case http.MethodDelete:
+		if !store.Delete(id) {
+			errorResponse(http.StatusNotFound, fmt.Sprintf("resource not found: %s", r.URL.Path), w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		errorResponse(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed on %s", r.Method, r.URL.Path), w)
+	}
+}
+
+// listResource responses items matching filters in query. Paging is enabled by the 'size' query parameter,
+// 'page' starts from 1. The number of all matching items is set in the X-Total-Count header.
+func listResource(store *resource.Store, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filters := make(map[string]string)
+	for k, values := range query {
+		if k != "page" && k != "size" {
+			filters[k] = values[0]
+		}
+	}
+	items := store.List(filters)
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+
+	if query.Get("size") != "" {
+		size, err := strconv.Atoi(query.Get("size"))
+		if err != nil || size < 1 {
+			errorResponse(http.StatusBadRequest, "size must be a positive integer", w)
+			return
+		}
+		page := 1
+		if query.Get("page") != "" {
+			page, err = strconv.Atoi(query.Get("page"))
+			if err != nil || page < 1 {
+				errorResponse(http.StatusBadRequest, "page must be a positive integer", w)
+				return
+			}
+		}
+
+		// compared before adding or multiplying, so huge pages and sizes don't overflow
+		start := len(items)
+		if page-1 <= len(items)/size {
+			start = (page - 1) * size
+		}
+		end := len(items)
+		if size < len(items)-start {
+			end = start + size
+		}
+		items = items[start:end]
+	}
+
+	jsonResponse(http.StatusOK, items, w)
+}
+
+// resourceItem returns the request body as an item, or responses 400 if it's not a JSON object
+func resourceItem(body *rules.RequestBody, w http.ResponseWriter) (resource.Item, bool) {
+	obj, ok := body.Value().(map[string]interface{})
+	if !ok {
+		errorResponse(http.StatusBadRequest, "request body must be a JSON object", w)
+		return nil, false
+	}
+	return obj, true
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+func TestResourcePaging(t *testing.T) {
+	h := newTestHandler(t, config.ServerConfig{}, config.Rule{
+		Name:     "users",
+		Resource: &config.ResourceRule{Path: "/users"},
+	})
+	for i := 0; i < 5; i++ {
+		status, body := serve(h, "POST", "/users", `{"name": "user `+strconv.Itoa(i)+`"}`)
+		if status != http.StatusCreated {
+			t.Fatalf("expected 201, got %d %s", status, body)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		status   int
+		expected []float64 // ids of listed items
+	}{
+		{query: "", status: http.StatusOK, expected: []float64{1, 2, 3, 4, 5}},
+		{query: "?size=2", status: http.StatusOK, expected: []float64{1, 2}},
+		{query: "?size=2&page=3", status: http.StatusOK, expected: []float64{5}},
+		{query: "?size=2&page=4", status: http.StatusOK, expected: []float64{}},
+		{query: "?size=5&page=2", status: http.StatusOK, expected: []float64{}},
+		{query: "?size=9223372036854775807", status: http.StatusOK, expected: []float64{1, 2, 3, 4, 5}},
+		{query: "?size=9223372036854775807&page=2", status: http.StatusOK, expected: []float64{}},
+		{query: "?size=2&page=9223372036854775807", status: http.StatusOK, expected: []float64{}},
+		{query: "?size=0", status: http.StatusBadRequest},
+		{query: "?size=-1", status: http.StatusBadRequest},
+		{query: "?size=2&page=0", status: http.StatusBadRequest},
+		{query: "?size=2&page=-1", status: http.StatusBadRequest},
+		{query: "?size=two", status: http.StatusBadRequest},
+		{query: "?size=99999999999999999999", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest("GET", "/users"+test.query, nil))
+			if w.Code != test.status {
+				t.Fatalf("expected %d, got %d %s", test.status, w.Code, w.Body.String())
+			}
+			if test.status != http.StatusOK {
+				return
+			}
+
+			if total := w.Header().Get("X-Total-Count"); total != "5" {
+				t.Errorf("expected X-Total-Count 5, got %s", total)
+			}
+			var items []map[string]interface{}
+			err := json.Unmarshal(w.Body.Bytes(), &items)
+			if err != nil {
+				t.Fatalf("expected a JSON array, got %s", w.Body.String())
+			}
+			ids := []float64{}
+			for _, item := range items {
+				ids = append(ids, item["id"].(float64))
+			}
+			if diff := cmp.Diff(test.expected, ids); diff != "" {
+				t.Errorf("unexpected ids of items (-expected +actual):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceResponse(t *testing.T) {
+	h := newTestHandler(t, config.ServerConfig{}, config.Rule{
+		Name:     "users",
+		Resource: &config.ResourceRule{Path: "/api/users"},
+	})
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		status   int
+		expected string // expected body, not checked if empty
+		location string
+		allow    string
+	}{
+		{name: "create", method: "POST", target: "/api/users", body: `{"name": "alice"}`, status: http.StatusCreated, expected: `{"id":1,"name":"alice"}`, location: "/api/users/1"},
+		{name: "create with id", method: "POST", target: "/api/users/", body: `{"id": 1000000, "name": "bob"}`, status: http.StatusCreated, location: "/api/users/1000000"},
+		{name: "create existing", method: "POST", target: "/api/users", body: `{"id": 1, "name": "carol"}`, status: http.StatusConflict},
+		{name: "create not object", method: "POST", target: "/api/users", body: `["alice"]`, status: http.StatusBadRequest},
+		{name: "get", method: "GET", target: "/api/users/1", status: http.StatusOK, expected: `{"id":1,"name":"alice"}`},
+		{name: "replace", method: "PUT", target: "/api/users/1", body: `{"name": "alicia"}`, status: http.StatusOK, expected: `{"id":1,"name":"alicia"}`},
+		{name: "patch", method: "PATCH", target: "/api/users/1", body: `{"role": "admin"}`, status: http.StatusOK, expected: `{"id":1,"name":"alicia","role":"admin"}`},
+		{name: "list filtered", method: "GET", target: "/api/users?role=admin", status: http.StatusOK, expected: `[{"id":1,"name":"alicia","role":"admin"}]`},
+		{name: "delete", method: "DELETE", target: "/api/users/1", status: http.StatusNoContent},
+		{name: "get deleted", method: "GET", target: "/api/users/1", status: http.StatusNotFound},
+		{name: "replace missing", method: "PUT", target: "/api/users/1", body: `{}`, status: http.StatusNotFound},
+		{name: "patch missing", method: "PATCH", target: "/api/users/1", body: `{}`, status: http.StatusNotFound},
+		{name: "delete missing", method: "DELETE", target: "/api/users/1", status: http.StatusNotFound},
+		{name: "nested path", method: "GET", target: "/api/users/1000000/posts", status: http.StatusNotFound},
+		{name: "collection method", method: "DELETE", target: "/api/users", status: http.StatusMethodNotAllowed, allow: "GET, POST"},
+		{name: "item method", method: "POST", target: "/api/users/1000000", body: `{}`, status: http.StatusMethodNotAllowed, allow: "GET, PUT, PATCH, DELETE"},
+		{name: "other path", method: "GET", target: "/api/usersx", status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+
+			if w.Code != test.status {
+				t.Fatalf("expected %d, got %d %s", test.status, w.Code, w.Body.String())
+			}
+			if test.expected != "" && w.Body.String() != test.expected {
+				t.Errorf("expected body %s, got %s", test.expected, w.Body.String())
+			}
+			if location := w.Header().Get("Location"); location != test.location {
+				t.Errorf("expected Location %q, got %q", test.location, location)
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("expected Allow %q, got %q", test.allow, allow)
+			}
+		})
+	}
+}
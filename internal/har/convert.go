@@ -0,0 +1,191 @@
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/proxy"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// Options controls how entries are converted into rules
+type Options struct {
+	MatchRule   string   // 'loose|strict', body match rule of converted rules, defaults to strict. strings are matched literally in both
+	MaxBodySize int      // response bodies larger than this are moved into files, 0 keeps all bodies inline
+	FileDir     string   // directory response bodies are written into, file paths in rules are relative to it
+	Headers     []string // request headers matched by converted rules
+}
+
+// ConvertFile loads a HAR file and converts it into rules
+func ConvertFile(harPath string, opts Options) ([]config.Rule, error) {
+	h, err := LoadFromFile(harPath)
+	if err != nil {
+		return nil, err
+	}
+	return Convert(h, opts)
+}
+
+// Convert converts entries of a HAR into rules.
+// Identical requests are converted once, the first response is used.
+func Convert(h *HAR, opts Options) ([]config.Rule, error) {
+	matchRule := opts.MatchRule
+	if matchRule == "" {
+		matchRule = "strict"
+	}
+	if matchRule != "strict" && matchRule != "loose" {
+		return nil, fmt.Errorf("match rule must be loose or strict, actual: %s", matchRule)
+	}
+
+	converted := make([]config.Rule, 0, len(h.Log.Entries))
+	seen := make(map[string]bool)
+	for i, entry := range h.Log.Entries {
+		r, body, err := entry.Request.httpRequest()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert request of entry %d, err: %s", i, err.Error())
+		}
+
+		key := r.Method + " " + r.URL.RequestURI() + "\n" + body.Text()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		rule := config.Rule{
+			Name:    fmt.Sprintf("%s %s", r.Method, r.URL.RequestURI()),
+			Request: proxy.RequestRule(r, body, opts.Headers),
+		}
+		// strict bodies keep the 'exact' match rule of recorded requests, so strings are matched literally
+		if rule.Request.Body.Value != nil && matchRule == "loose" {
+			rule.Request.Body.MatchRule = matchRule
+			rule.Request.Body.Value = quoteStrings(rule.Request.Body.Value)
+		}
+
+		respBody, err := entry.Response.Content.bytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response of entry %d, err: %s", i, err.Error())
+		}
+
+		header := entry.Response.header()
+		if opts.MaxBodySize > 0 && len(respBody) > opts.MaxBodySize {
+			rule.Response = proxy.ResponseRule(entry.Response.Status, header, nil)
+			rule.Response.File, err = writeBodyFile(opts.FileDir, len(converted), entry.Response.Content.MimeType, respBody)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			rule.Response = proxy.ResponseRule(entry.Response.Status, header, respBody)
+		}
+
+		converted = append(converted, rule)
+	}
+
+	return converted, nil
+}
+
+// quoteStrings escapes strings in a body value, so they're matched literally as loose regexes
+func quoteStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return regexp.QuoteMeta(v)
+	case map[interface{}]interface{}:
+		quoted := make(map[interface{}]interface{}, len(v))
+		for k, e := range v {
+			quoted[k] = quoteStrings(e)
+		}
+		return quoted
+	case []interface{}:
+		quoted := make([]interface{}, len(v))
+		for i, e := range v {
+			quoted[i] = quoteStrings(e)
+		}
+		return quoted
+	default:
+		return v
+	}
+}
+
+// httpRequest recreates the request of an entry, with its already read body
+func (req *Request) httpRequest() (*http.Request, *rules.RequestBody, error) {
+	var body []byte
+	contentType := ""
+	if req.PostData != nil {
+		contentType = req.PostData.MimeType
+		body = []byte(req.PostData.Text)
+		if len(body) == 0 && len(req.PostData.Params) > 0 {
+			form := url.Values{}
+			for _, p := range req.PostData.Params {
+				form.Add(p.Name, p.Value)
+			}
+			body = []byte(form.Encode())
+		}
+	}
+
+	r, err := http.NewRequest(req.Method, req.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, h := range req.Headers {
+		if !strings.HasPrefix(h.Name, ":") {
+			r.Header.Add(h.Name, h.Value)
+		}
+	}
+	if contentType == "" {
+		contentType = r.Header.Get("Content-Type")
+	}
+
+	return r, rules.NewRequestBody(body, contentType), nil
+}
+
+// header returns headers of a response.
+// HTTP/2 pseudo headers are dropped, and so is Content-Encoding since HAR bodies are already decoded.
+func (resp *Response) header() http.Header {
+	header := http.Header{}
+	for _, h := range resp.Headers {
+		if strings.HasPrefix(h.Name, ":") || http.CanonicalHeaderKey(h.Name) == "Content-Encoding" {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+	if header.Get("Content-Type") == "" && resp.Content.MimeType != "" {
+		header.Set("Content-Type", resp.Content.MimeType)
+	}
+	return header
+}
+
+func (content *Content) bytes() ([]byte, error) {
+	if content.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(content.Text)
+	}
+	return []byte(content.Text), nil
+}
+
+// writeBodyFile writes a response body into the bodies directory under dir, returning its path relative to dir
+func writeBodyFile(dir string, index int, mimeType string, body []byte) (string, error) {
+	ext := ".bin"
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	err := os.MkdirAll(filepath.Join(dir, "bodies"), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Join("bodies", fmt.Sprintf("%d%s", index, ext))
+	err = ioutil.WriteFile(filepath.Join(dir, name), body, 0644)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(name), nil
+}
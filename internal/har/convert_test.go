@@ -0,0 +1,75 @@
+package har
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+func testHAR(body string) *HAR {
+	h := &HAR{}
+	h.Log.Entries = []Entry{
+		{
+			Request: Request{
+				Method:   "POST",
+				URL:      "http://example.com/orders",
+				PostData: &PostData{MimeType: "application/json", Text: body},
+			},
+			Response: Response{
+				Status:  201,
+				Content: Content{MimeType: "application/json", Text: `{"id": 1}`},
+			},
+		},
+	}
+	return h
+}
+
+func TestConvertMatchesRecordedBody(t *testing.T) {
+	recorded := `{"name": "f(x", "host": "a.b", "note": null, "tags": ["x+", null]}`
+	tests := []struct {
+		body     string
+		expected map[string]bool // match rule to whether the body matches
+	}{
+		{recorded, map[string]bool{"strict": true, "loose": true}},
+		{`{"name": "f(x", "host": "axb", "note": null, "tags": ["x+", null]}`, map[string]bool{"strict": false, "loose": false}},
+		{`{"name": "f(x", "host": "a.b", "note": null, "tags": ["xx", null]}`, map[string]bool{"strict": false, "loose": false}},
+		{`{"name": "f(x", "host": "a.b", "note": 1, "tags": ["x+", null]}`, map[string]bool{"strict": false, "loose": false}},
+		{`{"name": "f(x", "host": "a.b", "note": null, "tags": ["x+", null], "extra": 1}`, map[string]bool{"strict": false, "loose": false}},
+		{`{"name": "f(x", "host": "a.b"}`, map[string]bool{"strict": false, "loose": true}},
+	}
+
+	for _, matchRule := range []string{"strict", "loose"} {
+		converted, err := Convert(testHAR(recorded), Options{MatchRule: matchRule})
+		if err != nil {
+			t.Fatalf("%s: %s", matchRule, err)
+		}
+		if len(converted) != 1 {
+			t.Fatalf("%s: expected 1 rule, got %d", matchRule, len(converted))
+		}
+
+		rule, err := rules.CompileRule(converted[0])
+		if err != nil {
+			t.Fatalf("%s: failed to compile converted rule: %s", matchRule, err)
+		}
+
+		for _, test := range tests {
+			r := httptest.NewRequest("POST", "/orders", strings.NewReader(test.body))
+			match, _, err := rules.MatchRequest(rule, r, rules.NewRequestBody([]byte(test.body), "application/json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match != test.expected[matchRule] {
+				t.Errorf("%s %s: expected match %v, got %v", matchRule, test.body, test.expected[matchRule], match)
+			}
+		}
+	}
+}
+
+func TestConvertInvalidMatchRule(t *testing.T) {
+	_, err := Convert(testHAR(`{}`), Options{MatchRule: "regex"})
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
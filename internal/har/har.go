@@ -0,0 +1,72 @@
+package har
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// HAR represents a HTTP Archive, only fields used to create rules are decoded
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log represents the log of a HAR
+type Log struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Entry represents a request and its response
+type Entry struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request represents a request of an entry
+type Request struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Headers  []NameValue `json:"headers"`
+	PostData *PostData   `json:"postData,omitempty"`
+}
+
+// PostData represents the body of a request
+type PostData struct {
+	MimeType string      `json:"mimeType"`
+	Text     string      `json:"text"`
+	Params   []NameValue `json:"params"`
+}
+
+// Response represents a response of an entry
+type Response struct {
+	Status  int         `json:"status"`
+	Headers []NameValue `json:"headers"`
+	Content Content     `json:"content"`
+}
+
+// Content represents the body of a response. Encoding is 'base64' for binary bodies
+type Content struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// NameValue represents a header or a form parameter
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// LoadFromFile loads a HAR file
+func LoadFromFile(harPath string) (*HAR, error) {
+	bytes, err := ioutil.ReadFile(harPath)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HAR{}
+	err = json.Unmarshal(bytes, h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
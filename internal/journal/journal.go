@@ -0,0 +1,131 @@
+package journal
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultSize is the number of entries a journal keeps if no size is configured
+const DefaultSize = 1000
+
+// Entry represents a request served by a server, and how it was responded
+type Entry struct {
+	ID        int64                  `json:"id"`
+	Time      time.Time              `json:"time"`
+	Server    string                 `json:"server"` // address of the server receiving the request
+	Method    string                 `json:"method"`
+	URL       string                 `json:"url"`  // request URI, with the query
+	Path      string                 `json:"path"` // path of the URL
+	Headers   http.Header            `json:"headers"`
+	Body      string                 `json:"body"`
+	Rule      string                 `json:"rule"`                // name of the matched rule, empty if no rule matched
+	Variables map[string]interface{} `json:"variables,omitempty"` // variables captured by the matched rule
+	Status    int                    `json:"status"`              // 0 if no response was written, e.g. the connection was reset by a fault
+	LatencyMS float64                `json:"latency_ms"`
+}
+
+// Filter selects entries of a journal, zero fields match all entries
+type Filter struct {
+	Rule   string
+	Method string
+	Server string
+	Path   *regexp.Regexp // matches path of the URL
+	Since  time.Time
+	Until  time.Time
+	Limit  int // only the latest Limit entries are returned
+}
+
+// Journal keeps the latest requests in memory, older entries are dropped once it's full
+type Journal struct {
+	mtx     sync.Mutex
+	entries []Entry // ring buffer
+	next    int     // index of the next entry in entries
+	count   int
+	lastID  int64
+}
+
+// New creates a journal keeping at most size entries, DefaultSize if size is 0.
+// nil is returned if size is negative, which disables the journal.
+func New(size int) *Journal {
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = DefaultSize
+	}
+	return &Journal{entries: make([]Entry, size)}
+}
+
+// Add adds an entry into the journal, assigning its id
+func (j *Journal) Add(entry Entry) {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	j.lastID++
+	entry.ID = j.lastID
+	j.entries[j.next] = entry
+	j.next = (j.next + 1) % len(j.entries)
+	if j.count < len(j.entries) {
+		j.count++
+	}
+}
+
+// Entries returns entries matching the filter, oldest first
+func (j *Journal) Entries(filter Filter) []Entry {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	matched := make([]Entry, 0)
+	start := j.next - j.count
+	if start < 0 {
+		start += len(j.entries)
+	}
+	for i := 0; i < j.count; i++ {
+		entry := j.entries[(start+i)%len(j.entries)]
+		if filter.Match(&entry) {
+			matched = append(matched, entry)
+		}
+	}
+
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[len(matched)-filter.Limit:]
+	}
+	return matched
+}
+
+// Reset removes all entries
+func (j *Journal) Reset() {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	for i := range j.entries {
+		j.entries[i] = Entry{}
+	}
+	j.next = 0
+	j.count = 0
+}
+
+// Match returns whether the entry matches the filter
+func (filter *Filter) Match(entry *Entry) bool {
+	if filter.Rule != "" && entry.Rule != filter.Rule {
+		return false
+	}
+	if filter.Method != "" && entry.Method != filter.Method {
+		return false
+	}
+	if filter.Server != "" && entry.Server != filter.Server {
+		return false
+	}
+	if filter.Path != nil && !filter.Path.MatchString(entry.Path) {
+		return false
+	}
+	if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && entry.Time.After(filter.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package journal
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// paths returns the path of entries
+func paths(entries []Entry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Path
+	}
+	return result
+}
+
+func TestNew(t *testing.T) {
+	if j := New(-1); j != nil {
+		t.Errorf("expected a negative size to disable the journal")
+	}
+	if j := New(0); len(j.entries) != DefaultSize {
+		t.Errorf("expected %d entries by default, got %d", DefaultSize, len(j.entries))
+	}
+	if j := New(3); len(j.entries) != 3 {
+		t.Errorf("expected 3 entries, got %d", len(j.entries))
+	}
+}
+
+func TestJournalEvictsOldestEntries(t *testing.T) {
+	j := New(3)
+	for _, path := range []string{"/1", "/2", "/3"} {
+		j.Add(Entry{Path: path})
+	}
+	if diff := cmp.Diff([]string{"/1", "/2", "/3"}, paths(j.Entries(Filter{}))); diff != "" {
+		t.Errorf("unexpected entries of a full journal (-expected +actual):\n%s", diff)
+	}
+
+	for _, path := range []string{"/4", "/5"} {
+		j.Add(Entry{Path: path})
+	}
+	entries := j.Entries(Filter{})
+	if diff := cmp.Diff([]string{"/3", "/4", "/5"}, paths(entries)); diff != "" {
+		t.Errorf("unexpected entries after eviction (-expected +actual):\n%s", diff)
+	}
+	if entries[0].ID != 3 || entries[2].ID != 5 {
+		t.Errorf("expected ids to keep increasing, got %d to %d", entries[0].ID, entries[2].ID)
+	}
+
+	j.Reset()
+	if entries := j.Entries(Filter{}); len(entries) != 0 {
+		t.Errorf("expected no entries after reset, got %v", paths(entries))
+	}
+	j.Add(Entry{Path: "/6"})
+	entries = j.Entries(Filter{})
+	if diff := cmp.Diff([]string{"/6"}, paths(entries)); diff != "" || entries[0].ID != 6 {
+		t.Errorf("expected entries to be added after reset with ids continued, got %v", entries)
+	}
+}
+
+func TestJournalFilter(t *testing.T) {
+	now := time.Now()
+	j := New(10)
+	j.Add(Entry{Path: "/books/1", Method: "GET", Rule: "get book", Server: ":8080", Time: now.Add(-time.Hour)})
+	j.Add(Entry{Path: "/books", Method: "POST", Rule: "create book", Server: ":8080", Time: now.Add(-time.Minute)})
+	j.Add(Entry{Path: "/users/1", Method: "GET", Server: ":8081", Time: now})
+	j.Add(Entry{Path: "/books/2", Method: "GET", Rule: "get book", Server: ":8080", Time: now})
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{name: "all", filter: Filter{}, expected: []string{"/books/1", "/books", "/users/1", "/books/2"}},
+		{name: "rule", filter: Filter{Rule: "get book"}, expected: []string{"/books/1", "/books/2"}},
+		{name: "method", filter: Filter{Method: "POST"}, expected: []string{"/books"}},
+		{name: "server", filter: Filter{Server: ":8081"}, expected: []string{"/users/1"}},
+		{name: "path", filter: Filter{Path: regexp.MustCompile(`^/books/\d+$`)}, expected: []string{"/books/1", "/books/2"}},
+		{name: "since", filter: Filter{Since: now.Add(-2 * time.Minute)}, expected: []string{"/books", "/users/1", "/books/2"}},
+		{name: "until", filter: Filter{Until: now.Add(-2 * time.Minute)}, expected: []string{"/books/1"}},
+		{name: "limit", filter: Filter{Method: "GET", Limit: 2}, expected: []string{"/users/1", "/books/2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if diff := cmp.Diff(test.expected, paths(j.Entries(test.filter))); diff != "" {
+				t.Errorf("unexpected entries (-expected +actual):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/rules"
+
+	"gopkg.in/yaml.v2"
+)
+
+// hopHeaders are headers of a single connection, which aren't forwarded or recorded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Recorder forwards requests to an upstream, and records rules replaying the responses into a file.
+type Recorder struct {
+	upstream *url.URL
+	file     string
+	headers  []string
+	client   *http.Client
+
+	mtx      sync.Mutex
+	recorded map[string]bool // keys of recorded requests, so identical requests are recorded once
+}
+
+// NewRecorder creates a Recorder from a proxy config in record mode. A relative file path is resolved against dir.
+func NewRecorder(proxy config.ProxyConfig, dir string) (*Recorder, error) {
+	upstream, err := url.Parse(proxy.Upstream)
+	if err != nil || upstream.Scheme == "" || upstream.Host == "" {
+		return nil, fmt.Errorf("proxy.upstream must be an absolute URL, actual: %s", proxy.Upstream)
+	}
+	if proxy.File == "" {
+		return nil, fmt.Errorf("proxy.file must be set in record mode")
+	}
+
+	rec := &Recorder{
+		upstream: upstream,
+		file:     RecordFile(proxy, dir),
+		headers:  proxy.Headers,
+		client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		recorded: make(map[string]bool),
+	}
+	return rec, nil
+}
+
+// RecordFile returns path of the file recorded rules are saved into
+func RecordFile(proxy config.ProxyConfig, dir string) string {
+	if dir == "" || filepath.IsAbs(proxy.File) {
+		return proxy.File
+	}
+	return filepath.Join(dir, proxy.File)
+}
+
+// Forward forwards the request to the upstream, writes the upstream response, and records it as a rule.
+// body is the already read body of the request.
+func (rec *Recorder) Forward(w http.ResponseWriter, r *http.Request, body *rules.RequestBody) {
+	target := *rec.upstream
+	target.Path = singleJoiningSlash(rec.upstream.Path, r.URL.Path)
+	target.RawQuery = r.URL.RawQuery
+	log.Printf("Forwarding request to %s", target.String())
+
+	outReq, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		writeError(http.StatusBadGateway, fmt.Sprintf("Failed to create upstream request, err: %s", err.Error()), w)
+		return
+	}
+	outReq = outReq.WithContext(r.Context())
+	copyHeader(outReq.Header, r.Header)
+
+	resp, err := rec.client.Do(outReq)
+	if err != nil {
+		writeError(http.StatusBadGateway, fmt.Sprintf("Failed to forward request, err: %s", err.Error()), w)
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		writeError(http.StatusBadGateway, fmt.Sprintf("Failed to read upstream response, err: %s", err.Error()), w)
+		return
+	}
+
+	copyHeader(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(respBody)
+
+	err = rec.record(r, body, resp, respBody)
+	if err != nil {
+		log.Printf("Failed to record rule, err: %s", err.Error())
+	}
+}
+
+// record appends a rule replaying the response to the record file, unless an identical request was recorded
+func (rec *Recorder) record(r *http.Request, body *rules.RequestBody, resp *http.Response, respBody []byte) error {
+	key := r.Method + " " + r.URL.RequestURI() + "\n" + body.Text()
+
+	rec.mtx.Lock()
+	defer rec.mtx.Unlock()
+
+	if rec.recorded[key] {
+		return nil
+	}
+
+	recordConfig := &config.Config{}
+	if _, err := os.Stat(rec.file); err == nil {
+		recordConfig, err = config.LoadConfigFromFile(rec.file)
+		if err != nil {
+			return err
+		}
+		for i := range recordConfig.Rules {
+			recordConfig.Rules[i].Dir = ""
+		}
+	}
+
+	rule := config.Rule{
+		Name:     fmt.Sprintf("recorded: %s %s", r.Method, r.URL.RequestURI()),
+		Request:  RequestRule(r, body, rec.headers),
+		Response: ResponseRule(resp.StatusCode, resp.Header, respBody),
+	}
+	recordConfig.Rules = append(recordConfig.Rules, rule)
+
+	err := config.SaveConfigToFile(recordConfig, rec.file)
+	if err != nil {
+		return err
+	}
+
+	rec.recorded[key] = true
+	log.Printf("Recorded rule '%s' into %s", rule.Name, rec.file)
+	return nil
+}
+
+// RequestRule creates a request rule matching exactly the method, path, query, body, and the selected headers of a request
+func RequestRule(r *http.Request, body *rules.RequestBody, headers []string) config.RequestRule {
+	requestRule := config.RequestRule{
+		Path:   rules.LiteralPath(r.URL.Path),
+		Method: r.Method,
+	}
+
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := query[name]
+		if len(values) == 1 {
+			requestRule.Query = append(requestRule.Query, config.QueryRule{Name: name, Value: values[0]})
+		} else {
+			requestRule.Query = append(requestRule.Query, config.QueryRule{Name: name, Values: values})
+		}
+	}
+
+	for _, name := range headers {
+		value := r.Header.Get(name)
+		if value != "" {
+			requestRule.Headers = append(requestRule.Headers, config.HeaderRule{Name: name, Value: value})
+		}
+	}
+
+	if len(body.Bytes()) > 0 {
+		requestRule.Body = config.RequestBodyRule{
+			MatchRule: "exact",
+			Value:     yamlValue(body.Value()),
+		}
+	}
+
+	return requestRule
+}
+
+// ResponseRule creates a response rule replaying a response.
+// JSON bodies are saved as objects, other text bodies verbatim, and binary bodies in base64.
+// Bodies which look like templates are saved in base64 as well, so they're not rendered.
+func ResponseRule(status int, header http.Header, body []byte) config.ResponseRule {
+	responseRule := config.ResponseRule{
+		Status: config.StatusCode(fmt.Sprint(status)),
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		if isHopHeader(name) || name == "Content-Length" || name == "Date" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if !strings.Contains(value, "{{") {
+				responseRule.Headers = append(responseRule.Headers, fmt.Sprintf("%s: %s", name, value))
+			}
+		}
+	}
+
+	if len(body) == 0 {
+		return responseRule
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	var obj interface{}
+	switch {
+	case bytes.Contains(body, []byte("{{")) || !utf8.Valid(body):
+		responseRule.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+
+	case (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && json.Unmarshal(body, &obj) == nil && obj != nil:
+		responseRule.Body = yamlValue(obj)
+
+	default:
+		responseRule.BodyRaw = string(body)
+	}
+
+	return responseRule
+}
+
+// yamlValue converts a decoded JSON or form value into the types a value loaded from YAML has,
+// so rules can be compiled without saving them first
+func yamlValue(value interface{}) interface{} {
+	bytes, err := yaml.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var converted interface{}
+	err = yaml.Unmarshal(bytes, &converted)
+	if err != nil {
+		return value
+	}
+	return converted
+}
+
+func isHopHeader(name string) bool {
+	for _, h := range hopHeaders {
+		if http.CanonicalHeaderKey(name) == h {
+			return true
+		}
+	}
+	return false
+}
+
+func copyHeader(dst http.Header, src http.Header) {
+	for k, values := range src {
+		if isHopHeader(k) {
+			continue
+		}
+		for _, v := range values {
+			dst.Add(k, v)
+		}
+	}
+}
+
+func singleJoiningSlash(a string, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func writeError(statusCode int, errorMsg string, w http.ResponseWriter) {
+	log.Println(errorMsg)
+	w.WriteHeader(statusCode)
+	w.Write([]byte(errorMsg))
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+type testRequest struct {
+	method string
+	target string
+	body   string
+}
+
+func (tr testRequest) request() (*http.Request, *rules.RequestBody) {
+	r := httptest.NewRequest(tr.method, tr.target, strings.NewReader(tr.body))
+	contentType := ""
+	if tr.body != "" {
+		contentType = "application/json"
+		r.Header.Set("Content-Type", contentType)
+	}
+	r.Header.Set("Authorization", "Bearer token")
+	return r, rules.NewRequestBody([]byte(tr.body), contentType)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `", "empty": null}`))
+	}))
+	defer upstream.Close()
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec, err := NewRecorder(config.ProxyConfig{
+		Upstream: upstream.URL,
+		Mode:     "record",
+		File:     "recorded.yaml",
+		Headers:  []string{"Authorization"},
+	}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := []testRequest{
+		{"POST", "/orders?q=1%2B1", `{"a": null, "name": "f(x)+1", "items": [1, "b", null], "nested": {"ok": true}}`},
+		{"GET", "/search/a.b?q=a.b", ""},
+		{"PUT", "/orders/1", `null`},
+	}
+	for _, tr := range recorded {
+		r, body := tr.request()
+		w := httptest.NewRecorder()
+		rec.Forward(w, r, body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: expected status 200, got %d", tr.method, tr.target, w.Code)
+		}
+	}
+
+	loaded, err := config.LoadConfigFromFile(RecordFile(config.ProxyConfig{File: "recorded.yaml"}, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Rules) != len(recorded) {
+		t.Fatalf("expected %d recorded rules, got %d", len(recorded), len(loaded.Rules))
+	}
+
+	compiledRules := make([]*rules.CompiledRule, len(loaded.Rules))
+	for i, rule := range loaded.Rules {
+		compiledRules[i], err = rules.CompileRule(rule)
+		if err != nil {
+			t.Fatalf("failed to compile recorded rule %s: %s", rule.Name, err)
+		}
+	}
+	rs := rules.NewRuleSet(compiledRules)
+
+	for i, tr := range recorded {
+		r, body := tr.request()
+		rule, _, err := rules.FindMatchingRule(rs, r, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule != compiledRules[i] {
+			t.Errorf("%s %s: expected to be replayed by recorded rule %d", tr.method, tr.target, i)
+		}
+	}
+
+	notRecorded := []testRequest{
+		{"POST", "/orders?q=11", `{"a": null, "name": "f(x)+1", "items": [1, "b", null], "nested": {"ok": true}}`},
+		{"POST", "/orders?q=1%2B1", `{"a": 1, "name": "f(x)+1", "items": [1, "b", null], "nested": {"ok": true}}`},
+		{"POST", "/orders?q=1%2B1", `{"a": null, "name": "f(x)1", "items": [1, "b", null], "nested": {"ok": true}}`},
+		{"POST", "/orders?q=1%2B1", `{"a": null, "name": "f(x)+1", "items": [1, "b", null]}`},
+		{"GET", "/search/axb?q=a.b", ""},
+		{"GET", "/search/a.b?q=axb", ""},
+		{"PUT", "/orders/1", `{}`},
+	}
+	for _, tr := range notRecorded {
+		r, body := tr.request()
+		rule, _, err := rules.FindMatchingRule(rs, r, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule != nil {
+			t.Errorf("%s %s %s: expected no rule to match, got %s", tr.method, tr.target, tr.body, rule.Name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package render
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// funcs are the helper functions available in response templates
+var funcs = template.FuncMap{
+	"now":          now,
+	"uuid":         UUID,
+	"randInt":      randInt,
+	"base64":       base64Encode,
+	"base64Decode": base64Decode,
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"trim":         strings.TrimSpace,
+	"default":      defaultValue,
+	"toJson":       toJSON,
+}
+
+// now returns the current time formatted with layout, RFC3339 is used if layout is omitted
+func now(layout ...string) string {
+	if len(layout) > 0 {
+		return time.Now().Format(layout[0])
+	}
+	return time.Now().Format(time.RFC3339)
+}
+
+// UUID returns a random version 4 UUID
+func UUID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randInt returns a random integer in [min, max)
+func randInt(min int, max int) (int, error) {
+	if max <= min {
+		return 0, fmt.Errorf("randInt: max must be greater than min")
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+	if err != nil {
+		return 0, err
+	}
+	return min + int(n.Int64()), nil
+}
+
+func base64Encode(value interface{}) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(value)))
+}
+
+func base64Decode(value string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// defaultValue returns value, or def if value is empty. It's used as '{{default "unknown" .name}}'
+func defaultValue(def interface{}, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return def
+	case string:
+		if v == "" {
+			return def
+		}
+	case bool:
+		if !v {
+			return def
+		}
+	}
+	return value
+}
+
+func toJSON(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,220 @@
+package render
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// ResponseTemplate is compiled from config.ResponseRule.
+// Errors in templates are caught and thrown during compilation.
+type ResponseTemplate struct {
+	status  *Template
+	headers []*Template
+	file    *Template
+	body    interface{} // body object with strings replaced by *Template
+	bodyRaw *Template
+	binary  []byte
+}
+
+// CompileResponse compiles all templates in a response rule
+func CompileResponse(rule config.ResponseRule) (*ResponseTemplate, error) {
+	var err error
+	rt := &ResponseTemplate{
+		headers: make([]*Template, len(rule.Headers)),
+	}
+
+	bodies := 0
+	for _, set := range []bool{rule.File != "", rule.Body != nil, rule.BodyRaw != "", rule.BodyBase64 != "", rule.Directory != ""} {
+		if set {
+			bodies++
+		}
+	}
+	if bodies > 1 {
+		return nil, fmt.Errorf("response rule should only have one of File, Body, BodyRaw, BodyBase64 and Directory")
+	}
+	if rule.Disposition != "" && rule.Disposition != "inline" && rule.Disposition != "attachment" {
+		return nil, fmt.Errorf("response rule disposition must be one of 'inline' and 'attachment'")
+	}
+
+	if rule.Status != "" {
+		rt.status, err = Compile(string(rule.Status))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, header := range rule.Headers {
+		rt.headers[i], err = Compile(header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.File != "" {
+		rt.file, err = Compile(rule.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rt.body, err = compileObject(rule.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.BodyRaw != "" {
+		rt.bodyRaw, err = Compile(rule.BodyRaw)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.BodyBase64 != "" {
+		rt.binary, err = base64.StdEncoding.DecodeString(rule.BodyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body, err: %s", err.Error())
+		}
+	}
+
+	return rt, nil
+}
+
+func compileObject(obj interface{}) (interface{}, error) {
+	switch o := obj.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+		for k, v := range o {
+			keyString, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key of map object must of string ")
+			}
+
+			compiled, err := compileObject(v)
+			if err != nil {
+				return nil, err
+			}
+			result[keyString] = compiled
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(o))
+		for i, v := range o {
+			compiled, err := compileObject(v)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = compiled
+		}
+		return result, nil
+
+	case string:
+		return Compile(o)
+
+	default:
+		return o, nil
+	}
+}
+
+// Status renders the status code, 0 is returned if the rule has no status
+func (rt *ResponseTemplate) Status(data Data) (int, error) {
+	if rt.status == nil {
+		return 0, nil
+	}
+
+	rendered, err := rt.status.Render(data)
+	if err != nil {
+		return 0, err
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(rendered))
+	if err != nil {
+		return 0, fmt.Errorf("status code must be a number, actual: %s", rendered)
+	}
+	return code, nil
+}
+
+// Headers renders the headers, each in form of "Key: value"
+func (rt *ResponseTemplate) Headers(data Data) ([]string, error) {
+	headers := make([]string, len(rt.headers))
+	for i, h := range rt.headers {
+		rendered, err := h.Render(data)
+		if err != nil {
+			return nil, err
+		}
+		headers[i] = rendered
+	}
+	return headers, nil
+}
+
+// File renders the file path, an empty string is returned if the rule has no file
+func (rt *ResponseTemplate) File(data Data) (string, error) {
+	if rt.file == nil {
+		return "", nil
+	}
+	return rt.file.Render(data)
+}
+
+// HasBody returns whether the rule has a body object
+func (rt *ResponseTemplate) HasBody() bool {
+	return rt.body != nil
+}
+
+// Body renders the body object into an object which can be marshaled into JSON
+func (rt *ResponseTemplate) Body(data Data) (interface{}, error) {
+	return renderObject(rt.body, data)
+}
+
+// HasRawBody returns whether the rule has a raw or binary body
+func (rt *ResponseTemplate) HasRawBody() bool {
+	return rt.bodyRaw != nil || rt.binary != nil
+}
+
+// RawBody renders the raw body, or returns the binary body as is
+func (rt *ResponseTemplate) RawBody(data Data) ([]byte, error) {
+	if rt.binary != nil {
+		return rt.binary, nil
+	}
+
+	rendered, err := rt.bodyRaw.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(rendered), nil
+}
+
+func renderObject(obj interface{}, data Data) (interface{}, error) {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(o))
+		for k, v := range o {
+			rendered, err := renderObject(v, data)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = rendered
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(o))
+		for i, v := range o {
+			rendered, err := renderObject(v, data)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+
+	case *Template:
+		return o.RenderValue(data)
+
+	default:
+		return o, nil
+	}
+}
@@ -0,0 +1,144 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is a text/template compiled from a string in a response rule.
+// The legacy '{{name}}' syntax is rewritten into '{{.name}}'. Missing variables and nil values render as empty strings
+// in both forms, rather than '<no value>'.
+type Template struct {
+	text     string
+	tmpl     *template.Template // nil if the text contains no action
+	variable string             // set if the whole text is a single '{{name}}'
+}
+
+// Data is the data response templates are executed with, keyed by variable name.
+type Data map[string]interface{}
+
+var legacyVariableRegex = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+var singleVariableRegex = regexp.MustCompile(`^{{\s*\.?(\w+)\s*}}$`)
+
+// keywords of text/template which may appear alone in an action
+var keywords = map[string]bool{
+	"else":     true,
+	"end":      true,
+	"break":    true,
+	"continue": true,
+	"nil":      true,
+	"true":     true,
+	"false":    true,
+}
+
+// Compile compiles text into a Template
+func Compile(text string) (*Template, error) {
+	t := &Template{
+		text: text,
+	}
+
+	if !strings.Contains(text, "{{") {
+		return t, nil
+	}
+
+	if matches := singleVariableRegex.FindStringSubmatch(text); matches != nil && isVariableName(matches[1]) {
+		t.variable = matches[1]
+	}
+
+	rewritten := legacyVariableRegex.ReplaceAllStringFunc(text, func(action string) string {
+		name := legacyVariableRegex.FindStringSubmatch(action)[1]
+		if !isVariableName(name) {
+			return action
+		}
+		return fmt.Sprintf(`{{default "" .%s}}`, name)
+	})
+
+	tmpl, err := template.New("").Funcs(funcs).Funcs(template.FuncMap{printFunc: printable}).Option("missingkey=zero").Parse(rewritten)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile template %s, err: %s", text, err.Error())
+	}
+	for _, defined := range tmpl.Templates() {
+		wrapActions(defined.Tree, defined.Tree.Root)
+	}
+	t.tmpl = tmpl
+
+	return t, nil
+}
+
+// printFunc is appended to actions printing a value, so nil values are printed as empty strings
+const printFunc = "_printable"
+
+func printable(value interface{}) interface{} {
+	if value == nil {
+		return ""
+	}
+	return value
+}
+
+// wrapActions appends printFunc to the pipelines of actions under node which print their values
+func wrapActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			wrapActions(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			identifier := parse.NewIdentifier(printFunc).SetTree(tree).SetPos(n.Pos)
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{identifier}})
+		}
+	case *parse.IfNode:
+		wrapActions(tree, n.List)
+		wrapActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		wrapActions(tree, n.List)
+		wrapActions(tree, n.ElseList)
+	case *parse.WithNode:
+		wrapActions(tree, n.List)
+		wrapActions(tree, n.ElseList)
+	}
+}
+
+func isVariableName(name string) bool {
+	_, isFunc := funcs[name]
+	return !isFunc && !keywords[name]
+}
+
+// Render executes the template and returns the result as a string
+func (t *Template) Render(data Data) (string, error) {
+	if t.tmpl == nil {
+		return t.text, nil
+	}
+
+	var buf bytes.Buffer
+	err := t.tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render template %s, err: %s", t.text, err.Error())
+	}
+	return buf.String(), nil
+}
+
+// RenderValue is like Render, but if the whole template is a single variable, the variable's value is returned as is,
+// so '{{id}}' is rendered as a number if id is an int variable.
+func (t *Template) RenderValue(data Data) (interface{}, error) {
+	if t.variable != "" {
+		return data[t.variable], nil
+	}
+	return t.Render(data)
+}
+
+// RenderText compiles and renders text in one go, e.g. for file contents which are only known when responding.
+func RenderText(text string, data Data) (string, error) {
+	t, err := Compile(text)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(data)
+}
@@ -0,0 +1,180 @@
+package render
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+func TestRender(t *testing.T) {
+	data := Data{
+		"name":  "bob",
+		"id":    42,
+		"empty": "",
+		"null":  nil,
+		"tags":  []interface{}{"a", "b"},
+	}
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"hi {{name}}", "hi bob"},
+		{"hi {{ name }} {{id}}", "hi bob 42"},
+		{"hi {{.name}}", "hi bob"},
+		{"hi {{missing}}.", "hi ."},
+		{"hi {{.missing}}.", "hi ."},
+		{"hi {{ .missing }} {{.null}}.", "hi  ."},
+		{"{{if .missing}}yes{{else}}no {{.missing}}{{end}}", "no "},
+		{"{{range .tags}}[{{.}}]{{end}}", "[a][b]"},
+		{"{{$n := .name}}{{$n}}", "bob"},
+		{"{{upper .name}} {{lower \"ABC\"}} {{trim \"  x  \"}}", "BOB abc x"},
+		{"{{default \"unknown\" .missing}} {{default \"unknown\" .empty}} {{default \"unknown\" .name}}", "unknown unknown bob"},
+		{"{{base64 .name}} {{base64Decode \"Ym9i\"}}", "Ym9i bob"},
+		{"{{toJson .tags}}", `["a","b"]`},
+		{"{{.name | upper}}", "BOB"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := Compile(test.text)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err)
+		}
+		rendered, err := tmpl.Render(data)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err)
+		}
+		if rendered != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.text, test.expected, rendered)
+		}
+	}
+}
+
+func TestRenderRandomHelpers(t *testing.T) {
+	tests := []struct {
+		text    string
+		pattern *regexp.Regexp
+	}{
+		{"{{uuid}}", regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{"{{randInt 5 8}}", regexp.MustCompile(`^[567]$`)},
+		{"{{now \"2006-01-02\"}}", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			rendered, err := RenderText(test.text, Data{})
+			if err != nil {
+				t.Fatalf("%s: %s", test.text, err)
+			}
+			if !test.pattern.MatchString(rendered) {
+				t.Errorf("%s: unexpected %q", test.text, rendered)
+			}
+		}
+	}
+
+	rendered, err := RenderText("{{now}}", Data{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := time.Parse(time.RFC3339, rendered); err != nil {
+		t.Errorf("expected now to default to RFC3339, got %q", rendered)
+	}
+}
+
+func TestRenderValue(t *testing.T) {
+	data := Data{"id": 42, "name": "bob"}
+
+	tests := []struct {
+		text     string
+		expected interface{}
+	}{
+		{"{{id}}", 42},
+		{"{{ .id }}", 42},
+		{"{{missing}}", nil},
+		{"id {{id}}", "id 42"},
+		{"{{upper .name}}", "BOB"},
+	}
+
+	for _, test := range tests {
+		tmpl, err := Compile(test.text)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err)
+		}
+		value, err := tmpl.RenderValue(data)
+		if err != nil {
+			t.Fatalf("%s: %s", test.text, err)
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: expected %#v, got %#v", test.text, test.expected, value)
+		}
+	}
+}
+
+func TestCompileInvalidTemplate(t *testing.T) {
+	for _, text := range []string{"{{if .a}}", "{{unknownFunc 1 2}}", "{{.a"} {
+		if _, err := Compile(text); err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		status   config.StatusCode
+		data     Data
+		expected int
+		fails    bool
+	}{
+		{"", nil, 0, false},
+		{"201", nil, 201, false},
+		{"{{code}}", Data{"code": 404}, 404, false},
+		{"{{if .found}}200{{else}}404{{end}}", Data{"found": false}, 404, false},
+		{" {{.code}} ", Data{"code": "503"}, 503, false},
+		{"{{.code}}", Data{}, 0, true},
+		{"abc", nil, 0, true},
+	}
+
+	for _, test := range tests {
+		rt, err := CompileResponse(config.ResponseRule{Status: test.status})
+		if err != nil {
+			t.Fatalf("%s: %s", test.status, err)
+		}
+		code, err := rt.Status(test.data)
+		if (err != nil) != test.fails {
+			t.Errorf("%s: expected error %v, got %v", test.status, test.fails, err)
+		}
+		if code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.status, test.expected, code)
+		}
+	}
+}
+
+func TestRenderBodyObject(t *testing.T) {
+	rt, err := CompileResponse(config.ResponseRule{
+		Body: map[interface{}]interface{}{
+			"id":    "{{id}}",
+			"label": "item {{id}} of {{.missing}}",
+			"tags":  []interface{}{"{{name}}", 1, true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := rt.Body(Data{"id": 7, "name": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"id":    7,
+		"label": "item 7 of ",
+		"tags":  []interface{}{"bob", 1, true},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected %#v, got %#v", expected, body)
+	}
+}
@@ -0,0 +1,278 @@
+package resource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/render"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Item is an item of a resource collection
+type Item map[string]interface{}
+
+// Store keeps the items of a resource collection in memory, it's safe for concurrent use.
+type Store struct {
+	idField string
+	idType  string
+	seed    []Item
+
+	mtx    sync.Mutex
+	items  []Item // in order of creation
+	nextID int
+}
+
+// NewStore creates a Store from a resource rule, seeded from the rule's seed file.
+// A relative seed path is resolved against dir.
+func NewStore(rule config.ResourceRule, dir string) (*Store, error) {
+	s := &Store{
+		idField: rule.IDField,
+		idType:  rule.IDType,
+		seed:    make([]Item, 0),
+	}
+	if s.idField == "" {
+		s.idField = "id"
+	}
+	if s.idType == "" {
+		s.idType = "int"
+	}
+	if s.idType != "int" && s.idType != "uuid" {
+		return nil, fmt.Errorf("resource.id_type must be one of 'int' and 'uuid'")
+	}
+
+	if rule.Seed != "" {
+		seedPath := rule.Seed
+		if dir != "" && !filepath.IsAbs(seedPath) {
+			seedPath = filepath.Join(dir, seedPath)
+		}
+
+		seed, err := loadSeed(seedPath, s.idField)
+		if err != nil {
+			return nil, err
+		}
+		s.seed = seed
+	}
+
+	s.Reset()
+	return s, nil
+}
+
+// loadSeed loads items from a YAML or JSON file with an array of objects
+func loadSeed(path string, idField string) ([]Item, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seed file %s, err: %s", path, err.Error())
+	}
+
+	var raw []interface{}
+	err = yaml.Unmarshal(content, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse seed file %s, err: %s", path, err.Error())
+	}
+
+	seed := make([]Item, len(raw))
+	ids := make(map[string]bool)
+	for i, r := range raw {
+		converted, err := config.JSONValue(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid item in seed file %s, err: %s", path, err.Error())
+		}
+		obj, ok := converted.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("items in seed file %s must be objects", path)
+		}
+
+		id, ok := obj[idField]
+		if !ok {
+			return nil, fmt.Errorf("item %d in seed file %s has no %s field", i, path, idField)
+		}
+		if ids[IDString(id)] {
+			return nil, fmt.Errorf("duplicated id %v in seed file %s", id, path)
+		}
+		ids[IDString(id)] = true
+
+		seed[i] = obj
+	}
+
+	return seed, nil
+}
+
+// IDField returns the name of the field holding item ids
+func (s *Store) IDField() string {
+	return s.idField
+}
+
+// Reset puts the store back to its seeded state
+func (s *Store) Reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.items = make([]Item, len(s.seed))
+	s.nextID = 1
+	for i, item := range s.seed {
+		s.items[i] = copyItem(item)
+		if id, err := strconv.Atoi(IDString(item[s.idField])); err == nil && id >= s.nextID {
+			s.nextID = id + 1
+		}
+	}
+}
+
+// List returns items whose fields equal to every filter, in order of creation
+func (s *Store) List(filters map[string]string) []Item {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	keys := make([]string, 0, len(filters))
+	for k := range filters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	items := make([]Item, 0)
+	for _, item := range s.items {
+		match := true
+		for _, k := range keys {
+			if IDString(item[k]) != filters[k] {
+				match = false
+				break
+			}
+		}
+		if match {
+			items = append(items, copyItem(item))
+		}
+	}
+	return items
+}
+
+// Get returns the item with id
+func (s *Store) Get(id string) (Item, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return nil, false
+	}
+	return copyItem(s.items[i]), true
+}
+
+// Create adds an item. An id is generated unless the item has one, false is returned if the id exists.
+func (s *Store) Create(item Item) (Item, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	item = copyItem(item)
+	id, ok := item[s.idField]
+	if ok {
+		if s.find(IDString(id)) >= 0 {
+			return nil, false, nil
+		}
+	} else {
+		generated, err := s.generateID()
+		if err != nil {
+			return nil, false, err
+		}
+		item[s.idField] = generated
+	}
+
+	if n, err := strconv.Atoi(IDString(item[s.idField])); err == nil && n >= s.nextID {
+		s.nextID = n + 1
+	}
+
+	s.items = append(s.items, item)
+	return copyItem(item), true, nil
+}
+
+// Replace replaces the item with id, false is returned if there's no such item
+func (s *Store) Replace(id string, item Item) (Item, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return nil, false
+	}
+
+	item = copyItem(item)
+	item[s.idField] = s.items[i][s.idField]
+	s.items[i] = item
+	return copyItem(item), true
+}
+
+// Patch merges fields into the item with id, false is returned if there's no such item
+func (s *Store) Patch(id string, fields Item) (Item, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return nil, false
+	}
+
+	item := s.items[i]
+	for k, v := range fields {
+		if k != s.idField {
+			item[k] = v
+		}
+	}
+	return copyItem(item), true
+}
+
+// Delete removes the item with id, false is returned if there's no such item
+func (s *Store) Delete(id string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	i := s.find(id)
+	if i < 0 {
+		return false
+	}
+	s.items = append(s.items[:i], s.items[i+1:]...)
+	return true
+}
+
+// IDString formats an id, or another field value, the way it's written in URLs.
+// JSON numbers are decoded as float64, whole numbers are formatted without an exponent, e.g. 1000000 rather than 1e+06.
+func IDString(id interface{}) string {
+	if f, ok := id.(float64); ok && f == math.Trunc(f) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(id)
+}
+
+// find returns index of the item with id, or -1. s.mtx must be held.
+func (s *Store) find(id string) int {
+	for i, item := range s.items {
+		if IDString(item[s.idField]) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// generateID returns a new id, s.mtx must be held.
+func (s *Store) generateID() (interface{}, error) {
+	if s.idType == "uuid" {
+		return render.UUID()
+	}
+
+	id := s.nextID
+	s.nextID++
+	return id, nil
+}
+
+// copyItem makes a shallow copy, so items in the store aren't changed by callers
+func copyItem(item Item) Item {
+	copied := make(Item, len(item))
+	for k, v := range item {
+		copied[k] = v
+	}
+	return copied
+}
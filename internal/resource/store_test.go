@@ -0,0 +1,194 @@
+package resource
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// newSeededStore creates a store seeded with items written in YAML
+func newSeededStore(t *testing.T, seed string) *Store {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	err = ioutil.WriteFile(filepath.Join(dir, "seed.yaml"), []byte(seed), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(config.ResourceRule{Path: "/users", Seed: "seed.yaml"}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStore(t *testing.T) {
+	s := newSeededStore(t, `
+- {id: 1, name: alice, role: admin}
+- {id: 7, name: bob, role: user}
+`)
+
+	if diff := cmp.Diff([]string{"alice", "bob"}, names(s.List(nil))); diff != "" {
+		t.Errorf("unexpected seeded items (-expected +actual):\n%s", diff)
+	}
+
+	created, ok, err := s.Create(Item{"name": "carol", "role": "user"})
+	if err != nil || !ok {
+		t.Fatalf("expected the item to be created, err: %v", err)
+	}
+	if id := IDString(created["id"]); id != "8" {
+		t.Errorf("expected the id after the largest seeded id, got %s", id)
+	}
+	_, ok, _ = s.Create(Item{"id": 7.0, "name": "bob again"})
+	if ok {
+		t.Errorf("expected creating an item with an existing id to fail")
+	}
+
+	if diff := cmp.Diff([]string{"bob", "carol"}, names(s.List(map[string]string{"role": "user"}))); diff != "" {
+		t.Errorf("unexpected filtered items (-expected +actual):\n%s", diff)
+	}
+	if items := s.List(map[string]string{"role": "user", "name": "alice"}); len(items) != 0 {
+		t.Errorf("expected every filter to be matched, got %v", items)
+	}
+
+	item, ok := s.Get("7")
+	if !ok || item["name"] != "bob" {
+		t.Errorf("expected to get bob, got %v", item)
+	}
+	item["name"] = "changed by caller"
+	if item, _ := s.Get("7"); item["name"] != "bob" {
+		t.Errorf("expected items in the store not to be changed by callers, got %v", item)
+	}
+
+	replaced, ok := s.Replace("7", Item{"id": 99, "name": "robert"})
+	if !ok || IDString(replaced["id"]) != "7" || replaced["role"] != nil {
+		t.Errorf("expected the item to be replaced keeping its id, got %v", replaced)
+	}
+
+	patched, ok := s.Patch("1", Item{"id": 99, "role": "user"})
+	if !ok || IDString(patched["id"]) != "1" || patched["name"] != "alice" || patched["role"] != "user" {
+		t.Errorf("expected fields to be merged keeping the id, got %v", patched)
+	}
+
+	if !s.Delete("8") {
+		t.Errorf("expected the item to be deleted")
+	}
+	if _, ok := s.Get("8"); ok {
+		t.Errorf("expected the deleted item to be gone")
+	}
+
+	for _, id := range []string{"8", "100"} {
+		if _, ok := s.Get(id); ok {
+			t.Errorf("expected no item %s", id)
+		}
+		if _, ok := s.Replace(id, Item{}); ok {
+			t.Errorf("expected replacing missing item %s to fail", id)
+		}
+		if _, ok := s.Patch(id, Item{}); ok {
+			t.Errorf("expected patching missing item %s to fail", id)
+		}
+		if s.Delete(id) {
+			t.Errorf("expected deleting missing item %s to fail", id)
+		}
+	}
+
+	s.Reset()
+	if diff := cmp.Diff([]string{"alice", "bob"}, names(s.List(nil))); diff != "" {
+		t.Errorf("unexpected items after reset (-expected +actual):\n%s", diff)
+	}
+	if item, _ := s.Get("1"); item["role"] != "admin" {
+		t.Errorf("expected the seeded item to be restored, got %v", item)
+	}
+	created, _, _ = s.Create(Item{"name": "dave"})
+	if id := IDString(created["id"]); id != "8" {
+		t.Errorf("expected ids to be generated from the seed again, got %s", id)
+	}
+}
+
+func TestStoreGeneratesUUIDs(t *testing.T) {
+	s, err := NewStore(config.ResourceRule{Path: "/users", IDField: "key", IDType: "uuid"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, _, err := s.Create(Item{"name": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, _ := s.Create(Item{"name": "bob"})
+	key, ok := first["key"].(string)
+	if !ok || len(key) != 36 || key == second["key"] {
+		t.Errorf("expected distinct UUIDs in the id field, got %v and %v", first["key"], second["key"])
+	}
+	if _, ok := s.Get(key); !ok {
+		t.Errorf("expected the item to be found by its UUID")
+	}
+}
+
+func TestNewStoreErrors(t *testing.T) {
+	_, err := NewStore(config.ResourceRule{Path: "/users", IDType: "string"}, "")
+	if err == nil {
+		t.Errorf("expected an error for an unknown id type")
+	}
+
+	_, err = NewStore(config.ResourceRule{Path: "/users", Seed: "missing.yaml"}, os.TempDir())
+	if err == nil {
+		t.Errorf("expected an error for a missing seed file")
+	}
+
+	for name, seed := range map[string]string{
+		"not objects":   "- 1\n- 2\n",
+		"no id":         "- {name: alice}\n",
+		"duplicated id": "- {id: 1}\n- {id: 1.0}\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "resource")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			err = ioutil.WriteFile(filepath.Join(dir, "seed.yaml"), []byte(seed), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = NewStore(config.ResourceRule{Path: "/users", Seed: "seed.yaml"}, dir)
+			if err == nil {
+				t.Errorf("expected an error for seed %q", seed)
+			}
+		})
+	}
+}
+
+func TestIDString(t *testing.T) {
+	tests := map[interface{}]string{
+		1:         "1",
+		1000000.0: "1000000",
+		1.5:       "1.5",
+		"abc":     "abc",
+		true:      "true",
+	}
+	for id, expected := range tests {
+		if actual := IDString(id); actual != expected {
+			t.Errorf("expected %v to be formatted as %s, got %s", id, expected, actual)
+		}
+	}
+}
+
+// names returns the name field of items
+func names(items []Item) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i], _ = item["name"].(string)
+	}
+	return result
+}
@@ -6,3 +6,7 @@ type anyRule struct {
 func (r *anyRule) Match(value interface{}, variables map[string]*Variable) (bool, map[string]*Variable, error) {
 	return true, variables, nil
 }
+
+func (r *anyRule) explain(value interface{}, field string) string {
+	return ""
+}
@@ -0,0 +1,47 @@
+package rules
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// AtomicRuleSet holds the current RuleSet.
+// Requests load a snapshot without locking, and changes swap in a new RuleSet, so requests in flight finish on the
+// snapshot they loaded. A RuleSet is never changed once it's stored.
+type AtomicRuleSet struct {
+	value atomic.Value // *RuleSet
+	mtx   sync.Mutex   // serializes writers, so concurrent updates aren't lost
+}
+
+// NewAtomicRuleSet creates an AtomicRuleSet holding rs
+func NewAtomicRuleSet(rs *RuleSet) *AtomicRuleSet {
+	a := &AtomicRuleSet{}
+	a.value.Store(rs)
+	return a
+}
+
+// Load returns the current snapshot
+func (a *AtomicRuleSet) Load() *RuleSet {
+	return a.value.Load().(*RuleSet)
+}
+
+// Store replaces the current snapshot by rs
+func (a *AtomicRuleSet) Store(rs *RuleSet) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.value.Store(rs)
+}
+
+// Update replaces the current snapshot by the one update creates from it.
+// Nothing is replaced if update returns an error.
+func (a *AtomicRuleSet) Update(update func(current *RuleSet) (*RuleSet, error)) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	rs, err := update(a.Load())
+	if err != nil {
+		return err
+	}
+	a.value.Store(rs)
+	return nil
+}
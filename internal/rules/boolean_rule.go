@@ -1,5 +1,7 @@
 package rules
 
+import "fmt"
+
 type booleanRule struct {
 	expected bool
 }
@@ -12,3 +14,14 @@ func (r *booleanRule) Match(value interface{}, variables map[string]*Variable) (
 
 	return r.expected == actual, variables, nil
 }
+
+func (r *booleanRule) explain(value interface{}, field string) string {
+	actual, ok := value.(bool)
+	if !ok {
+		return fmt.Sprintf("%s: expected boolean, got %s", fieldName(field), typeName(value))
+	}
+	if r.expected != actual {
+		return fmt.Sprintf("%s: expected %v, got %v", fieldName(field), r.expected, actual)
+	}
+	return ""
+}
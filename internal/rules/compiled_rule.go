@@ -1,20 +1,65 @@
 package rules
 
-import "github.com/imafish/http-test-server/internal/config"
+import (
+	"fmt"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/delay"
+	"github.com/imafish/http-test-server/internal/fault"
+	"github.com/imafish/http-test-server/internal/render"
+	"github.com/imafish/http-test-server/internal/resource"
+)
 
 // CompiledRule is compiled from config.Rule.
 // Errors are caught and thrown during compilation.
 type CompiledRule struct {
-	Request  CompiledRequestRule
-	Response config.ResponseRule
-	Name     string
+	ID        string
+	Config    config.Rule // the rule compiled from
+	Request   CompiledRequestRule
+	responses *responseSelector
+	Resource  *resource.Store // set for resource rules, which have no responses
+	Name      string
+	Dir       string // directory relative paths in the rule are resolved against
+
+	scenario      string
+	requiredState string
+	newState      string
+}
+
+// NextResponse returns the response to a request matching the rule.
+// For rules with multiple responses, it's chosen by the rule's response mode. It's safe for concurrent use.
+func (r *CompiledRule) NextResponse() *CompiledResponseRule {
+	return r.responses.next()
+}
+
+// ResetResponses restarts the sequence of responses of the rule
+func (r *CompiledRule) ResetResponses() {
+	r.responses.reset()
+}
+
+// PathRemainder returns the part of the request path matched by a trailing '**' in the rule's path,
+// an empty string is returned if the path has no '**'.
+func (r *CompiledRule) PathRemainder(requestPath string) string {
+	return r.Request.path.remainder(requestPath)
+}
+
+// CompiledResponseRule is the compiled version of config.ResponseRule
+type CompiledResponseRule struct {
+	config.ResponseRule
+	Template *render.ResponseTemplate
+	Delay    delay.Delay  // nil if the rule has no delay
+	Fault    *fault.Fault // nil if the rule has no fault
 }
 
+// anyMethod is the method of rules matching requests of any method, written as method: "*" in config, and set by resource rules
+const anyMethod = "*"
+
 // CompiledRequestRule is the compiled version of config.RequestRule
 // Errors are caught and thrown during compilation.
 type CompiledRequestRule struct {
-	path    string
-	headers []config.HeaderRule
+	path    *pathRule
+	query   []*queryRule
+	headers []*headerRule
 	method  string
 	body    BodyRule
 }
@@ -23,3 +68,41 @@ type CompiledRequestRule struct {
 type BodyRule interface {
 	Match(value interface{}, variables map[string]*Variable) (bool, map[string]*Variable, error)
 }
+
+// bodyExplainer is implemented by all body rules, it explains why a value doesn't match the rule.
+// An empty string is returned if the value matches.
+type bodyExplainer interface {
+	explain(value interface{}, field string) string
+}
+
+// explainBody explains why value doesn't match rule, field is the path of value in the request body.
+func explainBody(rule BodyRule, value interface{}, field string) string {
+	return rule.(bodyExplainer).explain(value, field)
+}
+
+func fieldName(field string) string {
+	if field == "" {
+		return "body"
+	}
+	return "body field " + field
+}
+
+// typeName returns the JSON type name of a decoded value
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
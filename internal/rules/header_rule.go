@@ -0,0 +1,72 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+type headerRule struct {
+	name    string   // header name, empty for Include and Not rules
+	matcher BodyRule // matches values of the named header. nil if the header only needs to be present
+	include *regexp.Regexp
+	not     *regexp.Regexp
+}
+
+func (r *headerRule) Match(header http.Header, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	if r.name != "" {
+		values := header.Values(r.name)
+		if len(values) == 0 {
+			return false, variables, nil
+		}
+		if r.matcher == nil {
+			return true, variables, nil
+		}
+
+		for _, v := range values {
+			var isMatch bool
+			var err error
+			isMatch, variables, err = r.matcher.Match(v, variables)
+			if err != nil {
+				return false, nil, err
+			}
+			if isMatch {
+				return true, variables, nil
+			}
+		}
+		return false, variables, nil
+	}
+
+	for k, values := range header {
+		for _, v := range values {
+			hs := fmt.Sprintf("%s: %s", k, v)
+			if r.include != nil && r.include.MatchString(hs) {
+				return true, variables, nil
+			}
+			if r.not != nil && r.not.MatchString(hs) {
+				return false, variables, nil
+			}
+		}
+	}
+
+	return r.include == nil, variables, nil
+}
+
+// explain returns the reason why the header rule doesn't match, or an empty string if it matches.
+func (r *headerRule) explain(header http.Header) string {
+	isMatch, _, _ := r.Match(header, make(map[string]*Variable))
+	if isMatch {
+		return ""
+	}
+
+	switch {
+	case r.name != "" && len(header.Values(r.name)) == 0:
+		return fmt.Sprintf("header %s: missing", r.name)
+	case r.name != "":
+		return fmt.Sprintf("header %s: %q doesn't match", r.name, header.Values(r.name))
+	case r.include != nil:
+		return fmt.Sprintf("header: no header matches '%s'", r.include.String())
+	default:
+		return fmt.Sprintf("header: a header matches '%s'", r.not.String())
+	}
+}
@@ -1,5 +1,10 @@
 package rules
 
+import (
+	"fmt"
+	"sort"
+)
+
 type mapRule struct {
 	strict   bool
 	subRules map[string]BodyRule
@@ -45,3 +50,47 @@ func (r *mapRule) Match(value interface{}, variables map[string]*Variable) (bool
 
 	return true, variables, nil
 }
+
+func (r *mapRule) explain(value interface{}, field string) string {
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Sprintf("%s: expected object, got %s", fieldName(field), typeName(value))
+	}
+
+	keys := make([]string, 0, len(valueMap))
+	for k := range valueMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		subField := joinField(field, k)
+		subRule := r.subRules[k]
+		if subRule == nil {
+			return fmt.Sprintf("%s: unexpected field", fieldName(subField))
+		}
+		if reason := explainBody(subRule, valueMap[k], subField); reason != "" {
+			return reason
+		}
+	}
+
+	if r.strict {
+		for k, v := range r.subRules {
+			if _, ok := v.(*anyRule); ok {
+				continue
+			}
+			if _, ok := valueMap[k]; !ok {
+				return fmt.Sprintf("%s: missing field", fieldName(joinField(field, k)))
+			}
+		}
+	}
+
+	return ""
+}
+
+func joinField(field string, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
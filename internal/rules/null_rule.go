@@ -0,0 +1,17 @@
+package rules
+
+import "fmt"
+
+type nullRule struct {
+}
+
+func (r *nullRule) Match(value interface{}, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	return value == nil, variables, nil
+}
+
+func (r *nullRule) explain(value interface{}, field string) string {
+	if value != nil {
+		return fmt.Sprintf("%s: expected null, got %s", fieldName(field), typeName(value))
+	}
+	return ""
+}
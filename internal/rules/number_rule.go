@@ -1,5 +1,7 @@
 package rules
 
+import "fmt"
+
 type numberRule struct {
 	expected float64
 }
@@ -12,3 +14,14 @@ func (r *numberRule) Match(value interface{}, variables map[string]*Variable) (b
 
 	return r.expected == actual, variables, nil
 }
+
+func (r *numberRule) explain(value interface{}, field string) string {
+	actual, ok := value.(float64)
+	if !ok {
+		return fmt.Sprintf("%s: expected number, got %s", fieldName(field), typeName(value))
+	}
+	if r.expected != actual {
+		return fmt.Sprintf("%s: expected %v, got %v", fieldName(field), r.expected, actual)
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type pathRule struct {
+	segments []*pathSegment
+	wildcard bool // if the path ends with '**', which matches any remaining segments
+}
+
+type pathSegment struct {
+	literal   string
+	isLiteral bool
+	regex     *regexp.Regexp
+	variables []*Variable
+}
+
+// splitPath splits a path into segments, the leading slashes are ignored.
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimLeft(path, "/"), "/")
+}
+
+// literalPrefix returns the leading segments which are matched exactly.
+func (r *pathRule) literalPrefix() []string {
+	prefix := make([]string, 0, len(r.segments))
+	for _, segment := range r.segments {
+		if !segment.isLiteral {
+			break
+		}
+		prefix = append(prefix, segment.literal)
+	}
+	return prefix
+}
+
+func (r *pathRule) matchSegmentCount(count int) bool {
+	if r.wildcard {
+		return count >= len(r.segments)
+	}
+	return count == len(r.segments)
+}
+
+// remainder returns the part of the request path matched by '**'
+func (r *pathRule) remainder(requestPath string) string {
+	if !r.wildcard {
+		return ""
+	}
+
+	requestSplits := splitPath(requestPath)
+	if len(requestSplits) < len(r.segments) {
+		return ""
+	}
+	return strings.Join(requestSplits[len(r.segments):], "/")
+}
+
+func (r *pathRule) Match(requestPath string, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	requestSplits := splitPath(requestPath)
+
+	if !r.matchSegmentCount(len(requestSplits)) {
+		return false, variables, nil
+	}
+
+	for i, segment := range r.segments {
+		pathPart := requestSplits[i]
+
+		if segment.isLiteral {
+			if segment.literal != pathPart {
+				return false, variables, nil
+			}
+			continue
+		}
+
+		if len(segment.variables) == 0 {
+			if !segment.regex.MatchString(pathPart) {
+				return false, variables, nil
+			}
+			continue
+		}
+
+		submatches := segment.regex.FindStringSubmatch(pathPart)
+		if submatches == nil {
+			return false, variables, nil
+		}
+		for j, sm := range submatches[1:] {
+			variable := segment.variables[j].parse(sm)
+			variables[variable.name] = variable
+		}
+	}
+
+	return true, variables, nil
+}
+
+// explain returns the number of matching segments, and the reason why the path doesn't match.
+func (r *pathRule) explain(requestPath string) (int, string) {
+	requestSplits := splitPath(requestPath)
+	if !r.matchSegmentCount(len(requestSplits)) {
+		if r.wildcard {
+			return 0, fmt.Sprintf("path: expected at least %d segments, got %d", len(r.segments), len(requestSplits))
+		}
+		return 0, fmt.Sprintf("path: expected %d segments, got %d", len(r.segments), len(requestSplits))
+	}
+
+	matched := 0
+	reason := ""
+	for i, segment := range r.segments {
+		pathPart := requestSplits[i]
+
+		var isMatch bool
+		var expected string
+		if segment.isLiteral {
+			isMatch = segment.literal == pathPart
+			expected = segment.literal
+		} else {
+			isMatch = segment.regex.MatchString(pathPart)
+			expected = segment.regex.String()
+		}
+
+		if isMatch {
+			matched++
+		} else if reason == "" {
+			reason = fmt.Sprintf("path segment %d: '%s' doesn't match '%s'", i, pathPart, expected)
+		}
+	}
+
+	return matched, reason
+}
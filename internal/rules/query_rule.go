@@ -0,0 +1,56 @@
+package rules
+
+import "fmt"
+
+type queryRule struct {
+	name     string
+	matchers []BodyRule
+	any      bool // if set, the only matcher may match any of the parameter's values
+}
+
+func (r *queryRule) Match(values []string, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	if r.any {
+		for _, v := range values {
+			var isMatch bool
+			var err error
+			isMatch, variables, err = r.matchers[0].Match(v, variables)
+			if err != nil {
+				return false, nil, err
+			}
+			if isMatch {
+				return true, variables, nil
+			}
+		}
+		return false, variables, nil
+	}
+
+	if len(values) != len(r.matchers) {
+		return false, variables, nil
+	}
+
+	for i, v := range values {
+		var isMatch bool
+		var err error
+		isMatch, variables, err = r.matchers[i].Match(v, variables)
+		if err != nil {
+			return false, nil, err
+		}
+		if !isMatch {
+			return false, variables, nil
+		}
+	}
+
+	return true, variables, nil
+}
+
+// explain returns the reason why the query parameter doesn't match, or an empty string if it matches.
+func (r *queryRule) explain(values []string) string {
+	isMatch, _, _ := r.Match(values, make(map[string]*Variable))
+	if isMatch {
+		return ""
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("query %s: missing", r.name)
+	}
+	return fmt.Sprintf("query %s: %q doesn't match", r.name, values)
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"encoding/json"
+	"mime"
+	"net/url"
+)
+
+// RequestBody holds the raw body of a request, and lazily decodes it at most once,
+// so the decoded value can be shared by all rules matched against the request.
+type RequestBody struct {
+	raw         []byte
+	contentType string
+
+	decoded   bool
+	value     interface{}
+	form      url.Values
+	formError error
+}
+
+// NewRequestBody creates a RequestBody from the raw body and the Content-Type header of the request.
+func NewRequestBody(raw []byte, contentType string) *RequestBody {
+	return &RequestBody{
+		raw:         raw,
+		contentType: contentType,
+	}
+}
+
+// Bytes returns the raw body
+func (b *RequestBody) Bytes() []byte {
+	return b.raw
+}
+
+// Text returns the raw body as a string
+func (b *RequestBody) Text() string {
+	return string(b.raw)
+}
+
+// Form returns the body parsed as an url-encoded form.
+func (b *RequestBody) Form() (url.Values, error) {
+	if b.form == nil && b.formError == nil {
+		b.form, b.formError = url.ParseQuery(string(b.raw))
+	}
+	return b.form, b.formError
+}
+
+// Value returns the object body rules are matched against.
+// JSON objects, arrays and numbers are decoded, url-encoded forms are converted into objects,
+// anything else is returned as text.
+func (b *RequestBody) Value() interface{} {
+	if b.decoded {
+		return b.value
+	}
+	b.decoded = true
+	b.value = b.Text()
+
+	var obj interface{}
+	err := json.Unmarshal(b.raw, &obj)
+	if err == nil {
+		switch obj.(type) {
+		case map[string]interface{}, []interface{}, float64:
+			b.value = obj
+			return b.value
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(b.contentType)
+	if mediaType == "application/x-www-form-urlencoded" {
+		form, err := b.Form()
+		if err == nil {
+			b.value = formToObject(form)
+		}
+	}
+
+	return b.value
+}
+
+// formToObject converts form values into an object: single values become strings, repeated values become arrays.
+func formToObject(form url.Values) map[string]interface{} {
+	obj := make(map[string]interface{}, len(form))
+	for k, values := range form {
+		if len(values) == 1 {
+			obj[k] = values[0]
+			continue
+		}
+
+		slice := make([]interface{}, len(values))
+		for i, v := range values {
+			slice[i] = v
+		}
+		obj[k] = slice
+	}
+	return obj
+}
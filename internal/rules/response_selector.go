@@ -0,0 +1,77 @@
+package rules
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type responseMode string
+
+const (
+	modeSequence responseMode = "sequence" // responses in order, then sticks on the last
+	modeCycle    responseMode = "cycle"    // responses in order, then starts over
+	modeRandom   responseMode = "random"   // a random response every time
+	modeWeighted responseMode = "weighted" // a random response, chosen by weight
+)
+
+// responseSelector chooses the response to a matching request
+type responseSelector struct {
+	mode        responseMode
+	responses   []*CompiledResponseRule
+	totalWeight int
+
+	mtx   sync.Mutex
+	count int
+	rnd   *rand.Rand
+}
+
+func (s *responseSelector) next() *CompiledResponseRule {
+	if len(s.responses) == 1 {
+		return s.responses[0]
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	count := s.count
+	s.count++
+
+	switch s.mode {
+	case modeCycle:
+		return s.responses[count%len(s.responses)]
+
+	case modeRandom:
+		return s.responses[s.random().Intn(len(s.responses))]
+
+	case modeWeighted:
+		n := s.random().Intn(s.totalWeight)
+		for _, r := range s.responses {
+			n -= r.Weight
+			if n < 0 {
+				return r
+			}
+		}
+		return s.responses[len(s.responses)-1]
+
+	default:
+		if count >= len(s.responses) {
+			count = len(s.responses) - 1
+		}
+		return s.responses[count]
+	}
+}
+
+func (s *responseSelector) reset() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.count = 0
+}
+
+// random returns the random source of the selector, s.mtx must be held
+func (s *responseSelector) random() *rand.Rand {
+	if s.rnd == nil {
+		s.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return s.rnd
+}
@@ -2,57 +2,490 @@ package rules
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/delay"
+	"github.com/imafish/http-test-server/internal/fault"
+	"github.com/imafish/http-test-server/internal/render"
+	"github.com/imafish/http-test-server/internal/resource"
 )
 
 // CompileRule compiled plain Rule object generated from a config file into compiled rules so it simplifies also decouple rule matching
 // Also it finds any errors in the plain Rule object and returns an error object
-// Currently only request body rule is compiled.
+// Request matchers and response templates are compiled.
 func CompileRule(rule config.Rule) (*CompiledRule, error) {
-	bodyRule, err := compileBodyRule(rule.Request.Body)
+	if rule.ID == "" {
+		id, err := render.UUID()
+		if err != nil {
+			return nil, err
+		}
+		rule.ID = id
+	}
+
+	if rule.Resource != nil {
+		return compileResourceRule(rule)
+	}
+
+	// variable names are shared by path and body, so a name can only be captured once per rule.
+	variableNames := make(map[string]bool)
+
+	pathRule, err := compilePathRule(rule.Request.Path, variableNames)
+	if err != nil {
+		return nil, err
+	}
+
+	queryRules, err := compileQueryRules(rule.Request.Query, variableNames)
+	if err != nil {
+		return nil, err
+	}
+
+	headerRules, err := compileHeaderRules(rule.Request.Headers, variableNames)
 	if err != nil {
 		return nil, err
 	}
 
+	bodyRule, err := compileBodyRule(rule.Request.Body, variableNames)
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := compileResponses(rule)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range responses.responses {
+		if r.Directory != "" && !pathRule.wildcard {
+			return nil, fmt.Errorf("rule with a directory response must have a path ending with '**'")
+		}
+	}
+
+	if rule.Scenario == "" && (rule.State != "" || rule.NewState != "") {
+		return nil, fmt.Errorf("rule with State or NewState must have a Scenario")
+	}
+
 	compiled := &CompiledRule{
 		Request: CompiledRequestRule{
-			path:    rule.Request.Path,
-			headers: rule.Request.Headers,
+			path:    pathRule,
+			query:   queryRules,
+			headers: headerRules,
 			method:  rule.Request.Method,
 			body:    bodyRule,
 		},
-		Response: rule.Response,
+		responses: responses,
+		ID:        rule.ID,
+		Config:    rule,
+		Name:      rule.Name,
+		Dir:       rule.Dir,
+
+		scenario:      rule.Scenario,
+		requiredState: rule.State,
+		newState:      rule.NewState,
+	}
+
+	return compiled, nil
+}
+
+// compileResourceRule compiles a rule serving an in-memory collection, which matches requests of any method
+// to the resource path and any path under it.
+func compileResourceRule(rule config.Rule) (*CompiledRule, error) {
+	if !reflect.DeepEqual(rule.Request, config.RequestRule{}) || !reflect.DeepEqual(rule.Response, config.ResponseRule{}) || len(rule.Responses) > 0 {
+		return nil, fmt.Errorf("resource rule must not have Request, Response or Responses")
+	}
+	if rule.Resource.Path == "" {
+		return nil, fmt.Errorf("resource rule must have a path")
+	}
+
+	// the resource path is matched exactly, not as regexes
+	resourcePath := strings.TrimRight(rule.Resource.Path, "/")
+	if resourcePath != "" {
+		resourcePath = LiteralPath(resourcePath)
+	}
+	pathRule, err := compilePathRule(resourcePath+"/**", make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := resource.NewStore(*rule.Resource, rule.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &CompiledRule{
+		Request: CompiledRequestRule{
+			path:   pathRule,
+			method: anyMethod,
+		},
+		ID:       rule.ID,
+		Config:   rule,
+		Resource: store,
 		Name:     rule.Name,
+		Dir:      rule.Dir,
+
+		scenario:      rule.Scenario,
+		requiredState: rule.State,
+		newState:      rule.NewState,
 	}
 
 	return compiled, nil
 }
 
-func compileBodyRule(bodyRule config.RequestBodyRule) (BodyRule, error) {
+func compileResponses(rule config.Rule) (*responseSelector, error) {
+	responseRules := rule.Responses
+	if len(responseRules) == 0 {
+		responseRules = []config.ResponseRule{rule.Response}
+	} else if !reflect.DeepEqual(rule.Response, config.ResponseRule{}) {
+		return nil, fmt.Errorf("rule should only have one of Response and Responses")
+	}
+
+	selector := &responseSelector{
+		mode:      responseMode(rule.ResponseMode),
+		responses: make([]*CompiledResponseRule, len(responseRules)),
+	}
+	if selector.mode == "" {
+		selector.mode = modeSequence
+	}
+	switch selector.mode {
+	case modeSequence, modeCycle, modeRandom, modeWeighted:
+	default:
+		return nil, fmt.Errorf("rule.ResponseMode must be one of 'sequence', 'cycle', 'random' and 'weighted'")
+	}
+
+	for i, r := range responseRules {
+		compiled, err := compileResponseRule(r)
+		if err != nil {
+			return nil, err
+		}
+		selector.responses[i] = compiled
+
+		if r.Weight < 0 {
+			return nil, fmt.Errorf("response weight must not be negative")
+		}
+		selector.totalWeight += r.Weight
+	}
+	if selector.mode == modeWeighted && selector.totalWeight == 0 {
+		return nil, fmt.Errorf("responses in weighted mode must have a positive total weight")
+	}
+
+	return selector, nil
+}
+
+func compileResponseRule(rule config.ResponseRule) (*CompiledResponseRule, error) {
+	responseTemplate, err := render.CompileResponse(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	responseDelay, err := delay.Compile(rule.Delay)
+	if err != nil {
+		return nil, err
+	}
+
+	responseFault, err := fault.Compile(rule.Fault)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &CompiledResponseRule{
+		ResponseRule: rule,
+		Template:     responseTemplate,
+		Delay:        responseDelay,
+		Fault:        responseFault,
+	}
+	return compiled, nil
+}
+
+// LiteralPath converts a request path into a rule path which only matches the request path,
+// segments are escaped and anchored, so they're matched exactly and can be indexed.
+func LiteralPath(requestPath string) string {
+	splits := splitPath(requestPath)
+	for i, split := range splits {
+		splits[i] = "^" + regexp.QuoteMeta(split) + "$"
+	}
+	return "/" + strings.Join(splits, "/")
+}
+
+// anchoredLiteral returns the text an anchored regex like '^v1\.0$' matches, if it matches nothing else
+func anchoredLiteral(segment string) (string, bool) {
+	if len(segment) < 2 || !strings.HasPrefix(segment, "^") || !strings.HasSuffix(segment, "$") {
+		return "", false
+	}
+
+	regex, err := regexp.Compile(segment[1 : len(segment)-1])
+	if err != nil {
+		return "", false
+	}
+	return regex.LiteralPrefix()
+}
+
+var matchPathVariableRegex = regexp.MustCompile(`{([A-Za-z_]\w*)(?::(\w+))?}`)
+
+// compilePathRule compiles a path such as /book/{id:int}/section/{section_id:string}.
+// Segments without a {name:type} placeholder are unanchored regexes, e.g. 'book' matches 'books' as well.
+// An anchored segment without other regex operators, e.g. '^book$', is matched exactly, and can be indexed.
+// Segments with placeholders must match completely, their literal parts are matched as-is.
+// The type of a placeholder defaults to string if omitted.
+// A trailing '**' segment matches any remaining segments, including none. '/**' matches any path.
+func compilePathRule(path string, variableNames map[string]bool) (*pathRule, error) {
+	splits := splitPath(path)
+
+	wildcard := false
+	if splits[len(splits)-1] == "**" {
+		wildcard = true
+		splits = splits[:len(splits)-1]
+	}
+
+	segments := make([]*pathSegment, len(splits))
+
+	for i, split := range splits {
+		if split == "**" {
+			return nil, fmt.Errorf("'**' can only be the last segment of path %s", path)
+		}
+
+		matches := matchPathVariableRegex.FindAllStringSubmatchIndex(split, -1)
+		if literal, ok := anchoredLiteral(split); matches == nil && ok {
+			segments[i] = &pathSegment{
+				literal:   literal,
+				isLiteral: true,
+			}
+			continue
+		}
+
+		if matches == nil {
+			regex, err := regexp.Compile(split)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to compile regex from %s, err: %s", split, err.Error())
+			}
+			segments[i] = &pathSegment{
+				regex: regex,
+			}
+			continue
+		}
+
+		startIndex := 0
+		regexString := "^"
+		extractedVariables := make([]*Variable, len(matches))
+		for j, matchIndex := range matches {
+			regexString += regexp.QuoteMeta(split[startIndex:matchIndex[0]])
+
+			variableName := split[matchIndex[2]:matchIndex[3]]
+			variableTypeStr := "string"
+			if matchIndex[4] >= 0 {
+				variableTypeStr = split[matchIndex[4]:matchIndex[5]]
+			}
+
+			variable, rulePart, err := newVariable(variableName, variableTypeStr, variableNames)
+			if err != nil {
+				return nil, err
+			}
+			regexString += rulePart
+			extractedVariables[j] = variable
+
+			startIndex = matchIndex[1]
+		}
+		regexString += regexp.QuoteMeta(split[startIndex:]) + "$"
+
+		regex, err := regexp.Compile(regexString)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile path segment %s into regex. err: %s", split, err.Error())
+		}
+		segments[i] = &pathSegment{
+			regex:     regex,
+			variables: extractedVariables,
+		}
+	}
+
+	return &pathRule{segments: segments, wildcard: wildcard}, nil
+}
+
+func compileQueryRules(rules []config.QueryRule, variableNames map[string]bool) ([]*queryRule, error) {
+	compiledRules := make([]*queryRule, len(rules))
+
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("query rule must have a name")
+		}
+
+		clauses := 0
+		for _, set := range []bool{r.Value != "", r.Values != nil, r.Regex != ""} {
+			if set {
+				clauses++
+			}
+		}
+		if clauses != 1 {
+			return nil, fmt.Errorf("query rule for %s must have exactly one of Value, Values and Regex clause", r.Name)
+		}
+
+		compiled := &queryRule{
+			name: r.Name,
+		}
+
+		if r.Values != nil {
+			compiled.matchers = make([]BodyRule, len(r.Values))
+			for j, v := range r.Values {
+				matcher, err := compileTextRule(v, matchExact, variableNames)
+				if err != nil {
+					return nil, err
+				}
+				compiled.matchers[j] = matcher
+			}
+
+		} else {
+			rule, mode := r.Value, matchExact
+			if rule == "" {
+				rule, mode = r.Regex, matchRegex
+			}
+
+			matcher, err := compileTextRule(rule, mode, variableNames)
+			if err != nil {
+				return nil, err
+			}
+			compiled.matchers = []BodyRule{matcher}
+			compiled.any = true
+		}
+
+		compiledRules[i] = compiled
+	}
+
+	return compiledRules, nil
+}
+
+func compileHeaderRules(rules []config.HeaderRule, variableNames map[string]bool) ([]*headerRule, error) {
+	compiledRules := make([]*headerRule, len(rules))
+
+	for i, r := range rules {
+		compiled := &headerRule{}
+
+		if r.Name != "" {
+			if r.Include != "" || r.Not != "" {
+				return nil, fmt.Errorf("header rule for %s must not have Include or Not clause", r.Name)
+			}
+			if r.Value != "" && r.Regex != "" {
+				return nil, fmt.Errorf("header rule for %s should only have one of Value and Regex clause", r.Name)
+			}
+
+			compiled.name = r.Name
+			if r.Value != "" || r.Regex != "" {
+				rule, mode := r.Value, matchExact
+				if rule == "" {
+					rule, mode = r.Regex, matchRegex
+				}
+
+				matcher, err := compileTextRule(rule, mode, variableNames)
+				if err != nil {
+					return nil, err
+				}
+				compiled.matcher = matcher
+			}
+
+		} else if r.Value != "" || r.Regex != "" {
+			return nil, fmt.Errorf("header rule with Value or Regex clause must have a Name")
+
+		} else if r.Include == "" && r.Not == "" {
+			return nil, fmt.Errorf("header rule must have one of Include and Not clause")
+
+		} else if r.Include != "" && r.Not != "" {
+			return nil, fmt.Errorf("header rule should only have one of Include and Not clause")
+
+		} else if r.Include != "" {
+			regx, err := regexp.Compile(r.Include)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to compile regex from %s, err: %s", r.Include, err.Error())
+			}
+			compiled.include = regx
+
+		} else {
+			regx, err := regexp.Compile(r.Not)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to compile regex from %s, err: %s", r.Not, err.Error())
+			}
+			compiled.not = regx
+		}
+
+		compiledRules[i] = compiled
+	}
+
+	return compiledRules, nil
+}
+
+// compileTextRule compiles a string rule which is always matched against text, e.g. values in URLs and headers.
+// Unlike JSON bodies, a single '{{name,int}}' is matched against the text rather than a number.
+func compileTextRule(rule string, mode stringMatch, variableNames map[string]bool) (BodyRule, error) {
+	compiled, err := compileStringRule(rule, mode, variableNames)
+	if err != nil {
+		return nil, err
+	}
+
+	if sr, ok := compiled.(*stringRule); ok {
+		sr.singleMatch = false
+	}
+
+	return compiled, nil
+}
+
+// newVariable registers a variable name and returns the variable object along with the regex used to capture its value.
+func newVariable(name string, typeStr string, variableNames map[string]bool) (*Variable, string, error) {
+	_, ok := variableNames[name]
+	if ok {
+		return nil, "", fmt.Errorf("multiple variable with name %s found in rules", name)
+	}
+	variableNames[name] = true
+
+	var rulePart string
+	var vType VariableType
+	switch typeStr {
+	case "int":
+		rulePart = `([-+]?\d+)`
+		vType = vtInt
+
+	case "string":
+		rulePart = `(.+)`
+		vType = vtString
+
+	case "float":
+		rulePart = `([-+]?[0-9]*\.?[0-9]+)`
+		vType = vtFloat
+
+	default:
+		return nil, "", fmt.Errorf("Invalid variable type %s found in rules", typeStr)
+	}
+
+	variable := &Variable{
+		name:  name,
+		vType: vType,
+	}
+	return variable, rulePart, nil
+}
+
+func compileBodyRule(bodyRule config.RequestBodyRule, variableNames map[string]bool) (BodyRule, error) {
 	if bodyRule.Value == nil && bodyRule.MatchRule == "" {
 		return nil, nil
 	}
 
-	var strict bool
+	var mode stringMatch
 	if bodyRule.MatchRule == "loose" || bodyRule.MatchRule == "" {
-		strict = false
+		mode = matchRegex
 	} else if bodyRule.MatchRule == "strict" {
-		strict = true
+		mode = matchStrict
+	} else if bodyRule.MatchRule == "exact" {
+		mode = matchExact
 	} else {
-		return nil, fmt.Errorf("bodyRule.compiledRule.MatchRule must be one of 'loose' and 'strict'")
+		return nil, fmt.Errorf("bodyRule.compiledRule.MatchRule must be one of 'loose', 'strict' and 'exact'")
+	}
+	// only recorded rules match null bodies, a missing value is more likely a mistake than null
+	if bodyRule.Value == nil && mode != matchExact {
+		return nil, fmt.Errorf("body rule with match_rule '%s' must have a value", bodyRule.MatchRule)
 	}
 
-	variableNames := make(map[string]bool)
-
-	return compileObject(bodyRule.Value, strict, variableNames)
+	return compileObject(bodyRule.Value, mode, variableNames)
 }
 
-func compileObject(value interface{}, strict bool, variableNames map[string]bool) (BodyRule, error) {
+func compileObject(value interface{}, mode stringMatch, variableNames map[string]bool) (BodyRule, error) {
 	switch e := value.(type) {
 	case string:
-		return compileStringRule(e, strict, variableNames)
+		return compileStringRule(e, mode, variableNames)
 
 	case float64:
 		compiled := &numberRule{
@@ -72,23 +505,26 @@ func compileObject(value interface{}, strict bool, variableNames map[string]bool
 		}
 		return compiled, nil
 
+	case nil:
+		return &nullRule{}, nil
+
 	case map[interface{}]interface{}:
-		return compileMap(e, strict, variableNames)
+		return compileMap(e, mode, variableNames)
 
 	case []interface{}:
-		return compileSlice(e, strict, variableNames)
+		return compileSlice(e, mode, variableNames)
 
 	default:
 		return nil, fmt.Errorf("Encountered invalid bodyRule.Value type")
 	}
 }
 
-func compileSlice(rules []interface{}, strict bool, variableNames map[string]bool) (BodyRule, error) {
+func compileSlice(rules []interface{}, mode stringMatch, variableNames map[string]bool) (BodyRule, error) {
 
 	compiledRules := make([]BodyRule, len(rules))
 
 	for i, v := range rules {
-		compiledRule, err := compileObject(v, strict, variableNames)
+		compiledRule, err := compileObject(v, mode, variableNames)
 		if err != nil {
 			return nil, err
 		}
@@ -103,7 +539,7 @@ func compileSlice(rules []interface{}, strict bool, variableNames map[string]boo
 	return sr, nil
 }
 
-func compileMap(rules map[interface{}]interface{}, strict bool, variableNames map[string]bool) (BodyRule, error) {
+func compileMap(rules map[interface{}]interface{}, mode stringMatch, variableNames map[string]bool) (BodyRule, error) {
 
 	compiledRules := make(map[string]BodyRule)
 
@@ -113,7 +549,7 @@ func compileMap(rules map[interface{}]interface{}, strict bool, variableNames ma
 			return nil, fmt.Errorf("key of map object in Rule must be of type string")
 		}
 
-		compiledRule, err := compileObject(v, strict, variableNames)
+		compiledRule, err := compileObject(v, mode, variableNames)
 		if err != nil {
 			return nil, err
 		}
@@ -122,7 +558,7 @@ func compileMap(rules map[interface{}]interface{}, strict bool, variableNames ma
 	}
 
 	mr := &mapRule{
-		strict:   strict,
+		strict:   mode != matchRegex,
 		subRules: compiledRules,
 	}
 
@@ -131,7 +567,16 @@ func compileMap(rules map[interface{}]interface{}, strict bool, variableNames ma
 
 var matchVariableRegex = regexp.MustCompile(`{{(\w+),(\w+)}}`)
 
-func compileStringRule(rule string, strict bool, variableNames map[string]bool) (BodyRule, error) {
+// stringMatch is how a string rule is matched, apart from its '{{name,type}}' placeholders
+type stringMatch int
+
+const (
+	matchRegex  stringMatch = iota // the rule is an unanchored regex
+	matchStrict                    // the rule is anchored, '.', '*', '[', ']', '(', ')' and '\' are matched literally
+	matchExact                     // the rule is anchored and matched literally
+)
+
+func compileStringRule(rule string, mode stringMatch, variableNames map[string]bool) (BodyRule, error) {
 
 	if rule == "{{ANY}}" {
 		return &anyRule{}, nil
@@ -148,54 +593,23 @@ func compileStringRule(rule string, strict bool, variableNames map[string]bool)
 
 	var regexString string
 	for i, matchIndex := range matches {
-		leadingPart := rule[startIndex:matchIndex[0]]
-		if strict {
-			leadingPart = escapeRegexSpecialCharacters(leadingPart)
-		}
-		regexString += leadingPart
+		regexString += escapeStringRule(rule[startIndex:matchIndex[0]], mode)
 
 		variableName := rule[matchIndex[2]:matchIndex[3]]
-		_, ok := variableNames[variableName]
-		if ok {
-			return nil, fmt.Errorf("multiple variable with name %s found in rules", variableName)
-		}
-		variableNames[variableName] = true
-
 		variableTypeStr := rule[matchIndex[4]:matchIndex[5]]
-		var rulePart string
-		var vType VariableType
-		switch variableTypeStr {
-		case "int":
-			rulePart = `([-+]?\d+)`
-			vType = vtInt
-
-		case "string":
-			rulePart = `(.+)`
-			vType = vtString
-
-		case "float":
-			rulePart = `([-+]?[0-9]*\.?[0-9]+)`
-			vType = vtFloat
-
-		default:
-			return nil, fmt.Errorf("Invalid variable type %s found in rules", variableTypeStr)
+		variable, rulePart, err := newVariable(variableName, variableTypeStr, variableNames)
+		if err != nil {
+			return nil, err
 		}
 		regexString += rulePart
-		extractedVariables[i] = &Variable{
-			name:  variableName,
-			vType: vType,
-		}
+		extractedVariables[i] = variable
 
 		startIndex = matchIndex[1]
 	}
 
-	endPart := rule[startIndex:]
-	if strict {
-		endPart = escapeRegexSpecialCharacters(endPart)
-	}
-	regexString += endPart
+	regexString += escapeStringRule(rule[startIndex:], mode)
 
-	if strict {
+	if mode != matchRegex {
 		regexString = "^" + regexString + "$"
 	}
 
@@ -213,6 +627,17 @@ func compileStringRule(rule string, strict bool, variableNames map[string]bool)
 	return compiled, nil
 }
 
+func escapeStringRule(unescaped string, mode stringMatch) string {
+	switch mode {
+	case matchStrict:
+		return escapeRegexSpecialCharacters(unescaped)
+	case matchExact:
+		return regexp.QuoteMeta(unescaped)
+	default:
+		return unescaped
+	}
+}
+
 var escapeRegex = regexp.MustCompile(`([\.\*\[\]\(\)\\])`)
 
 func escapeRegexSpecialCharacters(unescaped string) string {
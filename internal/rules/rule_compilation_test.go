@@ -0,0 +1,119 @@
+package rules
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+func TestCompileRootWildcardPath(t *testing.T) {
+	rs := compileTestRules(t, []config.Rule{
+		{
+			Name:     "cdn",
+			Request:  config.RequestRule{Method: "GET", Path: "/**"},
+			Response: config.ResponseRule{Directory: "fixtures"},
+		},
+	})
+
+	tests := []struct {
+		path      string
+		remainder string
+	}{
+		{"/", ""},
+		{"/index.html", "index.html"},
+		{"/css/site.css", "css/site.css"},
+	}
+
+	for _, test := range tests {
+		rule, _, err := FindMatchingRule(rs, httptest.NewRequest("GET", test.path, nil), NewRequestBody(nil, ""))
+		if err != nil {
+			t.Fatalf("%s: %s", test.path, err)
+		}
+		if rule == nil {
+			t.Errorf("%s: expected the rule to match", test.path)
+			continue
+		}
+		if remainder := rule.PathRemainder(test.path); remainder != test.remainder {
+			t.Errorf("%s: expected remainder %q, got %q", test.path, test.remainder, remainder)
+		}
+	}
+}
+
+func TestCompileInvalidWildcardPath(t *testing.T) {
+	rules := []config.Rule{
+		{
+			Name:     "wildcard in the middle",
+			Request:  config.RequestRule{Path: "/assets/**/index.html"},
+			Response: config.ResponseRule{Status: "200"},
+		},
+		{
+			Name:     "directory without wildcard",
+			Request:  config.RequestRule{Path: "/assets"},
+			Response: config.ResponseRule{Directory: "fixtures"},
+		},
+	}
+
+	for _, rule := range rules {
+		if _, err := CompileRule(rule); err == nil {
+			t.Errorf("%s: expected an error", rule.Name)
+		}
+	}
+}
+
+func TestCompileStringMatchRules(t *testing.T) {
+	tests := []struct {
+		matchRule string
+		rule      string
+		value     string
+		expected  bool
+	}{
+		{"loose", "a+b", "xaab", true},
+		{"strict", "a+b", "aab", true},
+		{"strict", "a+b", "a+b", false},
+		{"strict", "f(x).*", "f(x).*", true},
+		{"strict", "f(x).*", "f(x)y", false},
+		{"exact", "a+b", "a+b", true},
+		{"exact", "a+b", "aab", false},
+		{"exact", "^f(x)$|{y}?", "^f(x)$|{y}?", true},
+		{"exact", "id {{id,int}}+", "id 42+", true},
+	}
+
+	for _, test := range tests {
+		rule, err := compileBodyRule(config.RequestBodyRule{MatchRule: test.matchRule, Value: test.rule}, make(map[string]bool))
+		if err != nil {
+			t.Fatalf("%s %q: %s", test.matchRule, test.rule, err)
+		}
+		match, _, err := rule.Match(test.value, make(map[string]*Variable))
+		if err != nil {
+			t.Fatalf("%s %q: %s", test.matchRule, test.rule, err)
+		}
+		if match != test.expected {
+			t.Errorf("%s %q matching %q: expected %v, got %v", test.matchRule, test.rule, test.value, test.expected, match)
+		}
+	}
+}
+
+func TestCompileBodyRuleWithoutValue(t *testing.T) {
+	for _, matchRule := range []string{"loose", "strict"} {
+		_, err := compileBodyRule(config.RequestBodyRule{MatchRule: matchRule}, make(map[string]bool))
+		if err == nil {
+			t.Errorf("%s: expected an error for a body rule without value", matchRule)
+		}
+	}
+
+	rule, err := compileBodyRule(config.RequestBodyRule{}, make(map[string]bool))
+	if err != nil || rule != nil {
+		t.Errorf("expected no body rule without match_rule and value, got %v %v", rule, err)
+	}
+
+	// recorded rules match null bodies
+	rule, err = compileBodyRule(config.RequestBodyRule{MatchRule: "exact"}, make(map[string]bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	match, _, err := rule.Match(nil, make(map[string]*Variable))
+	if err != nil || !match {
+		t.Errorf("expected the exact rule to match null, got %v %v", match, err)
+	}
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// NearMiss describes how close a rule is to matching a request, and why it doesn't match.
+type NearMiss struct {
+	Rule       *CompiledRule
+	Index      int      // index of the rule in the rule set
+	Score      int      // number of criteria matched, higher is closer
+	Mismatches []string // every criterion which doesn't match
+}
+
+// FindNearMisses checks every rule against the request, and returns at most limit rules closest to matching it,
+// ordered by score. Rules with the same score keep their original order.
+func FindNearMisses(rules *RuleSet, request *http.Request, body *RequestBody, limit int) []*NearMiss {
+	nearMisses := make([]*NearMiss, 0, len(rules.rules))
+	for i, r := range rules.rules {
+		nm := diagnoseRule(r, request, body, rules.scenarios)
+		nm.Index = i
+		nearMisses = append(nearMisses, nm)
+	}
+
+	sort.SliceStable(nearMisses, func(i, j int) bool {
+		return nearMisses[i].Score > nearMisses[j].Score
+	})
+
+	if len(nearMisses) > limit {
+		nearMisses = nearMisses[:limit]
+	}
+	return nearMisses
+}
+
+// DiagnoseRequest checks every criterion of a rule against a request regardless of scenario states
+func DiagnoseRequest(rule *CompiledRule, request *http.Request, body *RequestBody) *NearMiss {
+	return diagnoseRule(rule, request, body, nil)
+}
+
+// diagnoseRule checks every criterion of a rule against the request, unlike matchRule it doesn't stop at the first mismatch.
+func diagnoseRule(rule *CompiledRule, request *http.Request, body *RequestBody, scenarios *Scenarios) *NearMiss {
+	requestRule := rule.Request
+	nm := &NearMiss{
+		Rule:       rule,
+		Mismatches: make([]string, 0),
+	}
+	check := func(reason string) {
+		if reason == "" {
+			nm.Score++
+		} else {
+			nm.Mismatches = append(nm.Mismatches, reason)
+		}
+	}
+
+	if requestRule.method != request.Method && requestRule.method != anyMethod {
+		check(fmt.Sprintf("method: expected %s, got %s", requestRule.method, request.Method))
+	} else {
+		check("")
+	}
+
+	matchedSegments, reason := requestRule.path.explain(request.URL.Path)
+	nm.Score += matchedSegments
+	check(reason)
+
+	query := request.URL.Query()
+	for _, qr := range requestRule.query {
+		check(qr.explain(query[qr.name]))
+	}
+
+	for _, hr := range requestRule.headers {
+		check(hr.explain(request.Header))
+	}
+
+	if requestRule.body != nil {
+		check(explainBody(requestRule.body, body.Value(), ""))
+	}
+
+	if rule.requiredState != "" {
+		if matchScenario(rule, scenarios) {
+			check("")
+		} else {
+			check(fmt.Sprintf("scenario %s: expected state %s, got %s", rule.scenario, rule.requiredState, scenarios.State(rule.scenario)))
+		}
+	}
+
+	return nm
+}
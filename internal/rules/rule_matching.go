@@ -1,174 +1,128 @@
 package rules
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
 	"net/http"
-	"regexp"
-	"strings"
-
-	"github.com/imafish/http-test-server/internal/config"
+	"net/url"
 )
 
-// FindMatchingRule returns the first matching rule from slices of rule
-func FindMatchingRule(rules *[]*CompiledRule, request *http.Request) (*CompiledRule, map[string]*Variable, error) {
-	var matchedRule *CompiledRule
-	variables := make(map[string]*Variable)
-
-	bytes, err := ioutil.ReadAll(request.Body)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	for _, r := range *rules {
-		requestRule := r.Request
-
-		match := (requestRule.method == request.Method)
-		if !match {
-			continue
-		}
-
-		match, err := matchPath(requestRule.path, request.RequestURI)
-		if err != nil {
-			return nil, nil, err
-		}
-		if !match {
+// FindMatchingRule returns the first matching rule from the rule set.
+// body is the already read body of the request, it's decoded at most once for all rules.
+// If the matching rule has a new state, its scenario transitions to it. Rules are matched concurrently,
+// so a rule requiring a state only matches if its scenario is still in that state when it transitions.
+func FindMatchingRule(rules *RuleSet, request *http.Request, body *RequestBody) (*CompiledRule, map[string]*Variable, error) {
+	for _, r := range rules.candidates(request.Method, request.URL.Path) {
+		if !matchScenario(r, rules.scenarios) {
 			continue
 		}
 
-		match, err = matchHeaders(requestRule.headers, request.Header)
+		match, variables, err := matchRule(r, request, body)
 		if err != nil {
 			return nil, nil, err
 		}
-		if !match {
-			continue
-		}
-
-		match, variables, err = matchBody(requestRule.body, bytes)
-		if err != nil {
-			return nil, nil, err
-		}
-		if !match {
-			continue
+		if match {
+			if r.newState != "" {
+				if r.requiredState == "" {
+					rules.scenarios.SetState(r.scenario, r.newState)
+				} else if !rules.scenarios.CompareAndSetState(r.scenario, r.requiredState, r.newState) {
+					continue
+				}
+			}
+			return r, variables, nil
 		}
-
-		matchedRule = r
-		break
 	}
 
-	return matchedRule, variables, nil
+	return nil, nil, nil
 }
 
-func matchPath(path string, requestPath string) (bool, error) {
-	// TODO @XG this method should return a 'context' map in future version.
-	// a context map stores path params extracted from request URI
-	// e.g.: /api/book/{id}/title, /api/book/2/title => [id]=2
+// MatchRequest matches a single rule against a request regardless of scenario states, e.g. to verify requests already received
+func MatchRequest(rule *CompiledRule, request *http.Request, body *RequestBody) (bool, map[string]*Variable, error) {
+	return matchRule(rule, request, body)
+}
 
-	ruleSplits := strings.Split(strings.TrimLeft(path, "/"), "/")
-	requestSplits := strings.Split(strings.TrimLeft(requestPath, "/"), "/")
+// matchRule matches a single rule against the request, returning variables captured by the rule
+func matchRule(rule *CompiledRule, request *http.Request, body *RequestBody) (bool, map[string]*Variable, error) {
+	requestRule := rule.Request
 
-	if len(ruleSplits) != len(requestSplits) {
-		return false, nil
+	if requestRule.method != request.Method && requestRule.method != anyMethod {
+		return false, nil, nil
 	}
 
-	for i, rs := range ruleSplits {
-		regx, err := regexp.Compile(rs)
-		if err != nil {
-			// TODO @XG move this erro checking to rule compilation phase
-			return false, fmt.Errorf("Failed to compile regex from %s, err: %s", rs, err.Error())
-		}
-
-		pathPart := requestSplits[i]
-		match := regx.MatchString(pathPart)
-		if !match {
-			return false, nil
-		}
+	variables := make(map[string]*Variable)
+	match, variables, err := matchPath(requestRule.path, request.URL.Path, variables)
+	if err != nil || !match {
+		return false, nil, err
 	}
 
-	return true, nil
-}
-
-func matchHeaders(headerRules []config.HeaderRule, requestHeader http.Header) (bool, error) {
-
-	requestHeaderStrings := make([]string, 0)
-	for k, v := range requestHeader {
-		for _, hs := range v {
-			requestHeaderStrings = append(requestHeaderStrings, fmt.Sprintf("%s: %s", k, hs))
-		}
+	match, variables, err = matchQuery(requestRule.query, request.URL.Query(), variables)
+	if err != nil || !match {
+		return false, nil, err
 	}
 
-	for _, hr := range headerRules {
-		match := false
+	match, variables, err = matchHeaders(requestRule.headers, request.Header, variables)
+	if err != nil || !match {
+		return false, nil, err
+	}
 
-		if hr.Include == "" && hr.Not == "" {
-			return false, fmt.Errorf("header rule must have one of Include and Not clause")
-		}
+	match, variables, err = matchBody(requestRule.body, body, variables)
+	if err != nil || !match {
+		return false, nil, err
+	}
 
-		if hr.Include != "" {
-			regx, err := regexp.Compile(hr.Include)
-			if err != nil {
-				return false, fmt.Errorf("Failed to compile regex from %s, err: %s", hr.Include, err.Error())
-			}
+	return true, variables, nil
+}
 
-			for _, hs := range requestHeaderStrings {
-				match = regx.MatchString(hs)
-				if match {
-					break
-				}
-			}
-			if !match {
-				return false, nil
-			}
+func matchScenario(rule *CompiledRule, scenarios *Scenarios) bool {
+	if rule.scenario == "" || rule.requiredState == "" {
+		return true
+	}
+	return scenarios.State(rule.scenario) == rule.requiredState
+}
 
-		} else if hr.Not != "" {
-			regx, err := regexp.Compile(hr.Not)
-			if err != nil {
-				return false, fmt.Errorf("Failed to compile regex from %s, err: %s", hr.Not, err.Error())
-			}
+func matchPath(rule *pathRule, requestPath string, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	if rule == nil {
+		return true, variables, nil
+	}
 
-			for _, hs := range requestHeaderStrings {
-				match = regx.MatchString(hs)
-				if match {
-					return false, nil
-				}
-			}
+	return rule.Match(requestPath, variables)
+}
 
-		} else {
-			return false, fmt.Errorf("header rule should only have one of Include and Not clause")
+func matchQuery(queryRules []*queryRule, query url.Values, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	for _, qr := range queryRules {
+		var match bool
+		var err error
+		match, variables, err = qr.Match(query[qr.name], variables)
+		if err != nil {
+			return false, nil, err
+		}
+		if !match {
+			return false, variables, nil
 		}
-
 	}
 
-	return true, nil
+	return true, variables, nil
 }
 
-func matchBody(bodyRule BodyRule, bytes []byte) (bool, map[string]*Variable, error) {
-
-	if bodyRule == nil {
-		return true, nil, nil
+func matchHeaders(headerRules []*headerRule, requestHeader http.Header, variables map[string]*Variable) (bool, map[string]*Variable, error) {
+	for _, hr := range headerRules {
+		var match bool
+		var err error
+		match, variables, err = hr.Match(requestHeader, variables)
+		if err != nil {
+			return false, nil, err
+		}
+		if !match {
+			return false, variables, nil
+		}
 	}
 
-	// TODO @XG this variables should be passed in from method parameter, as matchPath also generates variables.
-	variables := make(map[string]*Variable)
-
-	bodyObj := make(map[string]interface{})
-	err := json.Unmarshal(bytes, &bodyObj)
-	if err == nil {
-		return bodyRule.Match(bodyObj, variables)
-	}
+	return true, variables, nil
+}
 
-	bodySlice := make([]interface{}, 0)
-	err = json.Unmarshal(bytes, &bodySlice)
-	if err == nil {
-		return bodyRule.Match(bodySlice, variables)
-	}
+func matchBody(bodyRule BodyRule, body *RequestBody, variables map[string]*Variable) (bool, map[string]*Variable, error) {
 
-	var bodyNumber float64
-	err = json.Unmarshal(bytes, &bodyNumber)
-	if err == nil {
-		return bodyRule.Match(bodyNumber, variables)
+	if bodyRule == nil {
+		return true, variables, nil
 	}
 
-	return bodyRule.Match(string(bytes), variables)
+	return bodyRule.Match(body.Value(), variables)
 }
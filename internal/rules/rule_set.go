@@ -0,0 +1,147 @@
+package rules
+
+import (
+	"sort"
+)
+
+// RuleSet is an ordered collection of compiled rules, indexed by method and literal path prefix.
+// The index only narrows down candidates, the first matching rule in the original order always wins.
+type RuleSet struct {
+	rules     []*CompiledRule
+	index     map[string]*pathNode // keyed by method
+	scenarios *Scenarios
+}
+
+// pathNode is a node of the literal path prefix trie.
+type pathNode struct {
+	children  map[string]*pathNode
+	rules     map[int][]int // indices of rules ending their literal prefix at this node, keyed by segment count
+	wildcards map[int][]int // same as rules, but for paths ending with '**', keyed by the minimum segment count
+}
+
+func newPathNode() *pathNode {
+	return &pathNode{
+		children:  make(map[string]*pathNode),
+		rules:     make(map[int][]int),
+		wildcards: make(map[int][]int),
+	}
+}
+
+// NewRuleSet creates a RuleSet from compiled rules, the order of rules is preserved.
+// All scenarios of the rules start in StartedState.
+func NewRuleSet(rules []*CompiledRule) *RuleSet {
+	rs := &RuleSet{
+		rules:     rules,
+		index:     make(map[string]*pathNode),
+		scenarios: newScenarios(),
+	}
+
+	for i, r := range rules {
+		if r.scenario != "" {
+			rs.scenarios.register(r.scenario)
+		}
+
+		node := rs.index[r.Request.method]
+		if node == nil {
+			node = newPathNode()
+			rs.index[r.Request.method] = node
+		}
+
+		for _, segment := range r.Request.path.literalPrefix() {
+			child := node.children[segment]
+			if child == nil {
+				child = newPathNode()
+				node.children[segment] = child
+			}
+			node = child
+		}
+
+		segmentCount := len(r.Request.path.segments)
+		if r.Request.path.wildcard {
+			node.wildcards[segmentCount] = append(node.wildcards[segmentCount], i)
+		} else {
+			node.rules[segmentCount] = append(node.rules[segmentCount], i)
+		}
+	}
+
+	return rs
+}
+
+// WithRules creates a RuleSet of other rules sharing scenarios with rs, so states of scenarios are kept
+func (rs *RuleSet) WithRules(rules []*CompiledRule) *RuleSet {
+	newSet := NewRuleSet(rules)
+	for name := range newSet.scenarios.names {
+		rs.scenarios.register(name)
+	}
+	newSet.scenarios = rs.scenarios
+	return newSet
+}
+
+// collect appends indices of rules which may match the path segments to indices
+func (node *pathNode) collect(splits []string, indices []int) []int {
+	if node == nil {
+		return indices
+	}
+
+	for i := 0; ; i++ {
+		indices = append(indices, node.rules[len(splits)]...)
+		for minCount, wildcards := range node.wildcards {
+			if len(splits) >= minCount {
+				indices = append(indices, wildcards...)
+			}
+		}
+		if i == len(splits) {
+			break
+		}
+
+		node = node.children[splits[i]]
+		if node == nil {
+			break
+		}
+	}
+
+	return indices
+}
+
+// Rules returns all rules in the set, in their original order.
+func (rs *RuleSet) Rules() []*CompiledRule {
+	return rs.rules
+}
+
+// Scenarios returns the states of scenarios of the rules
+func (rs *RuleSet) Scenarios() *Scenarios {
+	return rs.scenarios
+}
+
+// candidates returns rules which may match the method and path, in their original order.
+func (rs *RuleSet) candidates(method string, path string) []*CompiledRule {
+	splits := splitPath(path)
+	indices := make([]int, 0)
+	indices = rs.index[method].collect(splits, indices)
+	indices = rs.index[anyMethod].collect(splits, indices)
+
+	sort.Ints(indices)
+
+	candidates := make([]*CompiledRule, len(indices))
+	for i, index := range indices {
+		candidates[i] = rs.rules[index]
+	}
+	return candidates
+}
+
+// ResetResponses restarts the response sequences of rules with the given name, or of all rules if name is empty.
+// The number of rules reset is returned.
+func (rs *RuleSet) ResetResponses(name string) int {
+	count := 0
+	for _, r := range rs.rules {
+		// resource rules have no responses, their items are kept
+		if r.responses == nil {
+			continue
+		}
+		if name == "" || r.Name == name {
+			r.ResetResponses()
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,272 @@
+package rules
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/imafish/http-test-server/internal/config"
+)
+
+// benchmarkPath returns the rule path of the i-th benchmark rule, and a request path matching it.
+// Segments are anchored, so they're matched exactly and indexed.
+func benchmarkPath(i int) (string, string) {
+	switch i % 3 {
+	case 0:
+		return fmt.Sprintf("/^api$/^v1$/^resource%d$/{id:int}", i), fmt.Sprintf("/api/v1/resource%d/42", i)
+	case 1:
+		return fmt.Sprintf("/^api$/^v1$/^resource%d$/^items$/{item:string}", i), fmt.Sprintf("/api/v1/resource%d/items/abc", i)
+	default:
+		return fmt.Sprintf("/^api$/^v2$/^resource%d$", i), fmt.Sprintf("/api/v2/resource%d", i)
+	}
+}
+
+func benchmarkRuleSet(b *testing.B, ruleCount int) *RuleSet {
+	compiledRules := make([]*CompiledRule, 0, ruleCount)
+	for i := 0; i < ruleCount; i++ {
+		path, _ := benchmarkPath(i)
+
+		r, err := CompileRule(config.Rule{
+			Name: fmt.Sprintf("rule %d", i),
+			Request: config.RequestRule{
+				Method: "GET",
+				Path:   path,
+			},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		compiledRules = append(compiledRules, r)
+	}
+
+	return NewRuleSet(compiledRules)
+}
+
+func BenchmarkFindMatchingRule(b *testing.B) {
+	for _, ruleCount := range []int{10, 100, 1000, 10000} {
+		rs := benchmarkRuleSet(b, ruleCount)
+		// the last rule is the worst case for a linear scan
+		_, target := benchmarkPath(ruleCount - 1)
+
+		b.Run(fmt.Sprintf("rules=%d", ruleCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				request := httptest.NewRequest("GET", target, nil)
+				rule, _, err := FindMatchingRule(rs, request, NewRequestBody(nil, ""))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if rule == nil {
+					b.Fatalf("expected %s to match a rule", target)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindMatchingRuleNoMatch(b *testing.B) {
+	for _, ruleCount := range []int{10, 100, 1000, 10000} {
+		rs := benchmarkRuleSet(b, ruleCount)
+
+		b.Run(fmt.Sprintf("rules=%d", ruleCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				request := httptest.NewRequest("GET", "/api/v3/unknown/1", nil)
+				rule, _, err := FindMatchingRule(rs, request, NewRequestBody(nil, ""))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if rule != nil {
+					b.Fatalf("expected no rule to match, got %s", rule.Name)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindMatchingRuleParallel(b *testing.B) {
+	for _, ruleCount := range []int{10, 1000} {
+		rs := NewAtomicRuleSet(benchmarkRuleSet(b, ruleCount))
+		_, target := benchmarkPath(ruleCount - 1)
+
+		b.Run(fmt.Sprintf("rules=%d", ruleCount), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					request := httptest.NewRequest("GET", target, nil)
+					rule, _, err := FindMatchingRule(rs.Load(), request, NewRequestBody(nil, ""))
+					if err != nil {
+						b.Fatal(err)
+					}
+					if rule == nil {
+						b.Fatalf("expected %s to match a rule", target)
+					}
+				}
+			})
+		})
+	}
+}
+
+func compileTestRules(t *testing.T, configs []config.Rule) *RuleSet {
+	compiledRules := make([]*CompiledRule, len(configs))
+	for i, c := range configs {
+		r, err := CompileRule(c)
+		if err != nil {
+			t.Fatalf("failed to compile rule %s: %s", c.Name, err)
+		}
+		compiledRules[i] = r
+	}
+	return NewRuleSet(compiledRules)
+}
+
+func TestFindMatchingRuleKeepsOrder(t *testing.T) {
+	rs := compileTestRules(t, []config.Rule{
+		{Name: "literal", Request: config.RequestRule{Method: "GET", Path: "/^api$/^book$"}},
+		{Name: "param", Request: config.RequestRule{Method: "GET", Path: "/api/books/{id:int}"}},
+		{Name: "regex", Request: config.RequestRule{Method: "GET", Path: "/api/book.*"}},
+		{Name: "resource", Resource: &config.ResourceRule{Path: "/api/users"}},
+		{Name: "shadowed by resource", Request: config.RequestRule{Method: "GET", Path: "/^api$/^users$"}},
+		{Name: "any method", Request: config.RequestRule{Method: "*", Path: "/^api$/**"}},
+		{Name: "shadowed by param", Request: config.RequestRule{Method: "GET", Path: "/^api$/^books$/^1$"}},
+		{Name: "shadowed by wildcard", Request: config.RequestRule{Method: "DELETE", Path: "/^api$/^orders$"}},
+		{Name: "other", Request: config.RequestRule{Method: "GET", Path: "/other/{name}"}},
+	})
+
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/api/book", "literal"},
+		{"GET", "/api/books/1", "param"},
+		{"GET", "/api/books", "regex"},
+		{"GET", "/api/bookshelf", "regex"},
+		{"GET", "/apiv2/book", "regex"},
+		{"GET", "/api/users", "resource"},
+		{"GET", "/api/users2", "any method"},
+		{"DELETE", "/api/users/1", "resource"},
+		{"POST", "/api/book", "any method"},
+		{"GET", "/api/books/abc", "any method"},
+		{"DELETE", "/api/orders", "any method"},
+		{"GET", "/api/a/b/c", "any method"},
+		{"GET", "/other/x", "other"},
+		{"GET", "/other/x/y", ""},
+		{"POST", "/other/x", ""},
+		{"GET", "/", ""},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		body := NewRequestBody(nil, "")
+
+		rule, _, err := FindMatchingRule(rs, request, body)
+		if err != nil {
+			t.Fatalf("%s %s: %s", test.method, test.path, err)
+		}
+		name := ""
+		if rule != nil {
+			name = rule.Name
+		}
+		if name != test.expected {
+			t.Errorf("%s %s: expected rule %q, got %q", test.method, test.path, test.expected, name)
+		}
+
+		// the index must not change the result of trying all rules in order
+		linear := ""
+		for _, r := range rs.Rules() {
+			match, _, err := MatchRequest(r, request, body)
+			if err != nil {
+				t.Fatalf("%s %s: %s", test.method, test.path, err)
+			}
+			if match {
+				linear = r.Name
+				break
+			}
+		}
+		if name != linear {
+			t.Errorf("%s %s: index found rule %q, linear scan found %q", test.method, test.path, name, linear)
+		}
+	}
+}
+
+func TestPathSegmentsAreUnanchoredRegexes(t *testing.T) {
+	tests := []struct {
+		path     string
+		request  string
+		expected bool
+	}{
+		{"/api/book", "/api/book", true},
+		{"/api/book", "/api/books", true},
+		{"/api/book", "/myapi/ebook", true},
+		{"/api/book", "/api/book/1", false},
+		{"/api/v1.0", "/api/v1x0", true},
+		{"/api/books?", "/api/book", true},
+		{"/^api$/^book$", "/api/books", false},
+		{"/^api$/^book$", "/api/book", true},
+		{"/^api$/^v1\\.0$", "/api/v1x0", false},
+		{"/^api$/^v1\\.0$", "/api/v1.0", true},
+	}
+
+	for _, test := range tests {
+		rs := compileTestRules(t, []config.Rule{{Name: test.path, Request: config.RequestRule{Method: "GET", Path: test.path}}})
+		rule, _, err := FindMatchingRule(rs, httptest.NewRequest("GET", test.request, nil), NewRequestBody(nil, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (rule != nil) != test.expected {
+			t.Errorf("%s matching %s: expected %v, got %v", test.path, test.request, test.expected, rule != nil)
+		}
+	}
+}
+
+func TestAnyMethod(t *testing.T) {
+	rs := compileTestRules(t, []config.Rule{
+		{Name: "get", Request: config.RequestRule{Method: "GET", Path: "/^items$"}},
+		{Name: "any", Request: config.RequestRule{Method: "*", Path: "/^items$"}},
+	})
+
+	tests := map[string]string{
+		"GET":    "get",
+		"POST":   "any",
+		"DELETE": "any",
+	}
+	for method, expected := range tests {
+		rule, _, err := FindMatchingRule(rs, httptest.NewRequest(method, "/items", nil), NewRequestBody(nil, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rule == nil || rule.Name != expected {
+			t.Errorf("expected %s to match rule '%s', got %v", method, expected, rule)
+		}
+	}
+}
+
+func TestResetResponses(t *testing.T) {
+	rs := compileTestRules(t, []config.Rule{
+		{
+			Name:    "retry me",
+			Request: config.RequestRule{Method: "GET", Path: "/unstable"},
+			Responses: []config.ResponseRule{
+				{BodyRaw: "first"},
+				{BodyRaw: "second"},
+			},
+		},
+		{
+			Name:     "users",
+			Resource: &config.ResourceRule{Path: "/users"},
+		},
+	})
+	retry := rs.rules[0]
+
+	retry.NextResponse()
+	if response := retry.NextResponse(); response.BodyRaw != "second" {
+		t.Fatalf("expected the second response, got %q", response.BodyRaw)
+	}
+
+	if count := rs.ResetResponses("users"); count != 0 {
+		t.Errorf("expected resource rules not to be reset, got %d rules reset", count)
+	}
+	if count := rs.ResetResponses(""); count != 1 {
+		t.Errorf("expected 1 rule to be reset, got %d", count)
+	}
+	if response := retry.NextResponse(); response.BodyRaw != "first" {
+		t.Errorf("expected the sequence to restart, got %q", response.BodyRaw)
+	}
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"sync"
+)
+
+// StartedState is the initial state of every scenario
+const StartedState = "Started"
+
+// Scenarios holds the current state of every scenario, it's safe for concurrent use.
+type Scenarios struct {
+	mtx    sync.Mutex
+	states map[string]string // scenarios not in the map are in StartedState
+	names  map[string]bool   // scenarios referred by rules
+}
+
+func newScenarios() *Scenarios {
+	return &Scenarios{
+		states: make(map[string]string),
+		names:  make(map[string]bool),
+	}
+}
+
+func (s *Scenarios) register(name string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.names[name] = true
+}
+
+// State returns the current state of a scenario
+func (s *Scenarios) State(name string) string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.state(name)
+}
+
+// Declared returns whether a scenario is referred by rules
+func (s *Scenarios) Declared(name string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.names[name]
+}
+
+func (s *Scenarios) state(name string) string {
+	state, ok := s.states[name]
+	if !ok {
+		return StartedState
+	}
+	return state
+}
+
+// SetState changes the current state of a scenario
+func (s *Scenarios) SetState(name string, state string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.states[name] = state
+	s.names[name] = true
+}
+
+// CompareAndSetState changes the state of a scenario to state only if it's currently in oldState,
+// returning whether the state was changed
+func (s *Scenarios) CompareAndSetState(name string, oldState string, state string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.state(name) != oldState {
+		return false
+	}
+	s.states[name] = state
+	s.names[name] = true
+	return true
+}
+
+// Reset puts a scenario back into StartedState, or all scenarios if name is empty
+func (s *Scenarios) Reset(name string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if name == "" {
+		s.states = make(map[string]string)
+	} else {
+		delete(s.states, name)
+	}
+}
+
+// States returns the current state of every known scenario
+func (s *Scenarios) States() map[string]string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	states := make(map[string]string, len(s.names))
+	for name := range s.names {
+		states[name] = s.state(name)
+	}
+	return states
+}
@@ -1,5 +1,7 @@
 package rules
 
+import "fmt"
+
 type sliceRule struct {
 	subRules []BodyRule
 }
@@ -31,3 +33,22 @@ func (r *sliceRule) Match(value interface{}, variables map[string]*Variable) (bo
 
 	return true, variables, nil
 }
+
+func (r *sliceRule) explain(value interface{}, field string) string {
+	sliceValue, ok := value.([]interface{})
+	if !ok {
+		return fmt.Sprintf("%s: expected array, got %s", fieldName(field), typeName(value))
+	}
+
+	if len(sliceValue) != len(r.subRules) {
+		return fmt.Sprintf("%s: expected %d elements, got %d", fieldName(field), len(r.subRules), len(sliceValue))
+	}
+
+	for i, ss := range sliceValue {
+		if reason := explainBody(r.subRules[i], ss, fmt.Sprintf("%s[%d]", field, i)); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"math"
 	"regexp"
-	"strconv"
 )
 
 type stringRule struct {
@@ -48,22 +47,29 @@ func (r *stringRule) Match(value interface{}, variables map[string]*Variable) (b
 	submatches := matches[0]
 	for i, sm := range submatches[1:] {
 
-		// Let's make a copy here, so the matched variable does alter variable objects in Rule
-		variable := *r.variables[i]
+		// parse makes a copy here, so the matched variable does alter variable objects in Rule
+		variable := r.variables[i].parse(sm)
+		variables[variable.name] = variable
+	}
 
-		switch variable.vType {
-		case vtInt:
-			variable.value, _ = strconv.Atoi(sm)
+	return true, variables, nil
+}
 
-		case vtString:
-			variable.value = sm
+func (r *stringRule) explain(value interface{}, field string) string {
+	isMatch, _, _ := r.Match(value, make(map[string]*Variable))
+	if isMatch {
+		return ""
+	}
 
-		case vtFloat:
-			variable.value, _ = strconv.ParseFloat(sm, 64)
+	if r.singleMatch && (r.variables[0].vType == vtInt || r.variables[0].vType == vtFloat) {
+		f, ok := value.(float64)
+		if !ok || (r.variables[0].vType == vtInt && math.Round(f) != f) {
+			return fmt.Sprintf("%s: expected %s, got %s '%v'", fieldName(field), r.variables[0].vType, typeName(value), value)
 		}
-
-		variables[variable.name] = &variable
 	}
 
-	return true, variables, nil
+	if _, ok := value.(string); !ok {
+		return fmt.Sprintf("%s: expected string, got %s", fieldName(field), typeName(value))
+	}
+	return fmt.Sprintf("%s: '%v' doesn't match '%s'", fieldName(field), value, r.regex.String())
 }
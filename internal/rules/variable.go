@@ -2,6 +2,7 @@ package rules
 
 import (
 	"fmt"
+	"strconv"
 )
 
 // Variable represents a variable when parsing request path or request body
@@ -20,6 +21,19 @@ const (
 	vtFloat
 )
 
+func (t VariableType) String() string {
+	switch t {
+	case vtInt:
+		return "int"
+	case vtString:
+		return "string"
+	case vtFloat:
+		return "float"
+	default:
+		return "unknown"
+	}
+}
+
 // GetValue returns variable's value, the returned object type is based on variable's type
 func (v *Variable) GetValue() (interface{}, error) {
 	var value interface{}
@@ -49,3 +63,21 @@ func (v *Variable) GetValue() (interface{}, error) {
 
 	return value, nil
 }
+
+// parse returns a copy of the variable whose value is parsed from raw according to the variable's type
+func (v *Variable) parse(raw string) *Variable {
+	variable := *v
+
+	switch variable.vType {
+	case vtInt:
+		variable.value, _ = strconv.Atoi(raw)
+
+	case vtString:
+		variable.value = raw
+
+	case vtFloat:
+		variable.value, _ = strconv.ParseFloat(raw, 64)
+	}
+
+	return &variable
+}
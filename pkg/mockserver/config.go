@@ -0,0 +1,129 @@
+package mockserver
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/har"
+	"github.com/imafish/http-test-server/internal/rules"
+)
+
+// Config types are aliases of the types a config file is decoded into, so configs can be built in Go.
+type (
+	Config          = config.Config
+	ServerConfig    = config.ServerConfig
+	ProxyConfig     = config.ProxyConfig
+	HarSource       = config.HarSource
+	Rule            = config.Rule
+	ResourceRule    = config.ResourceRule
+	RequestRule     = config.RequestRule
+	QueryRule       = config.QueryRule
+	HeaderRule      = config.HeaderRule
+	RequestBodyRule = config.RequestBodyRule
+	ResponseRule    = config.ResponseRule
+	StatusCode      = config.StatusCode
+	DelayRule       = config.DelayRule
+	FaultRule       = config.FaultRule
+)
+
+// LoadConfig loads a config file, relative paths in it are resolved against its directory
+func LoadConfig(configPath string) (*Config, error) {
+	return config.LoadConfigFromFile(configPath)
+}
+
+// validateConfig verifies whether manditory fields of servers exist in config object
+func validateConfig(config *Config) error {
+	for _, server := range config.Servers {
+		if server.Proxy != nil {
+			if server.Proxy.Mode != "record" && server.Proxy.Mode != "replay" {
+				return fmt.Errorf("server.proxy.mode must be record or replay, actual: %s", server.Proxy.Mode)
+			}
+			if server.Proxy.File == "" {
+				return fmt.Errorf("server.proxy.file is manditory")
+			}
+		}
+		if (server.CertFile != "" && server.KeyFile == "") || (server.KeyFile != "" && server.CertFile == "") {
+			return fmt.Errorf("server.CertFile and server.KeyFile must come in pair")
+		}
+	}
+	return nil
+}
+
+// compileRules compiles plain Rule objects of the config, followed by rules converted from its HAR files,
+// complaining any error found during the process
+func compileRules(config *Config) ([]*rules.CompiledRule, error) {
+	configRules := make([]Rule, len(config.Rules))
+	copy(configRules, config.Rules)
+
+	for _, source := range config.Har {
+		harRules, err := har.ConvertFile(source.File, har.Options{MatchRule: source.MatchRule})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load HAR file %s, err: %s", source.File, err.Error())
+		}
+
+		for _, r := range harRules {
+			r.Dir = filepath.Dir(source.File)
+			configRules = append(configRules, r)
+		}
+	}
+
+	return compileRuleList(configRules)
+}
+
+// loadRecordedRules loads rules recorded by a proxy in record mode.
+// The recorded rules replace all other rules of a server in replay mode.
+func loadRecordedRules(recordPath string) (*rules.RuleSet, error) {
+	recorded, err := config.LoadConfigFromFile(recordPath)
+	if err != nil {
+		return nil, err
+	}
+
+	compiledRules, err := compileRuleList(recorded.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded %d recorded rules from %s", len(compiledRules), recordPath)
+	return rules.NewRuleSet(compiledRules), nil
+}
+
+// compileRuleList compiles rules loaded from a config. Rules without an id get one derived from their position and name,
+// so it stays the same when the config is reloaded. Duplicated ids are rejected.
+func compileRuleList(configRules []Rule) ([]*rules.CompiledRule, error) {
+	compiledRules := make([]*rules.CompiledRule, len(configRules))
+	ids := make(map[string]bool)
+	for i, r := range configRules {
+		if r.ID == "" {
+			r.ID = ruleID(i, r.Name)
+		}
+		if ids[r.ID] {
+			return nil, fmt.Errorf("duplicated rule id: %s", r.ID)
+		}
+		ids[r.ID] = true
+
+		compiledRule, err := rules.CompileRule(r)
+		if err != nil {
+			return nil, err
+		}
+
+		compiledRules[i] = compiledRule
+	}
+
+	return compiledRules, nil
+}
+
+var nonWordRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ruleID derives the id of the i-th rule from its name, e.g. 'rule-3-get-book-section'
+func ruleID(i int, name string) string {
+	id := fmt.Sprintf("rule-%d", i)
+	slug := strings.Trim(nonWordRegex.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if slug != "" {
+		id += "-" + slug
+	}
+	return id
+}
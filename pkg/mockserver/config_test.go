@@ -0,0 +1,39 @@
+package mockserver
+
+import "testing"
+
+func TestCompileRulesDerivesStableIDs(t *testing.T) {
+	config := &Config{
+		Rules: []Rule{
+			{Name: "Get book section", Request: RequestRule{Path: "/a"}},
+			{ID: "explicit", Request: RequestRule{Path: "/b"}},
+			{Request: RequestRule{Path: "/c"}},
+		},
+	}
+	expected := []string{"rule-0-get-book-section", "explicit", "rule-2"}
+
+	for load := 0; load < 2; load++ {
+		compiledRules, err := compileRules(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, r := range compiledRules {
+			if r.ID != expected[i] {
+				t.Errorf("load %d: expected id %s of rule %d, got %s", load, expected[i], i, r.ID)
+			}
+		}
+	}
+}
+
+func TestCompileRulesRejectsDuplicatedIDs(t *testing.T) {
+	configs := []*Config{
+		{Rules: []Rule{{ID: "a"}, {ID: "a"}}},
+		{Rules: []Rule{{Name: "b"}, {ID: "rule-0-b"}}},
+	}
+
+	for i, config := range configs {
+		if _, err := compileRules(config); err == nil {
+			t.Errorf("config %d: expected duplicated ids to be rejected", i)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mockserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/handler"
+)
+
+// ShutdownTimeout is how long a stopped server waits for requests in flight, before closing their connections
+const ShutdownTimeout = 5 * time.Second
+
+// listener is a running server of a ServerConfig, or the admin listener
+type listener struct {
+	config         ServerConfig
+	httpServer     *http.Server
+	requestHandler *handler.RequestHandler // nil for the admin listener
+	url            string
+}
+
+// newListener prepares a listener of a server without listening yet,
+// so errors in the server config are found before a server it replaces is stopped
+func (s *Server) newListener(server ServerConfig) (*listener, error) {
+	h, err := s.requestHandler(server)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &listener{
+		config:         server,
+		httpServer:     &http.Server{Handler: h},
+		requestHandler: h,
+	}
+
+	if server.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(serverPath(server, server.CertFile), serverPath(server, server.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load key pair of server %s, err: %s", server.Addr, err.Error())
+		}
+		l.httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		if !server.HTTP2 {
+			// HTTP/2 connections can't be hijacked, so faults breaking the connection need HTTP/1.1
+			l.httpServer.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		}
+	}
+
+	return l, nil
+}
+
+// serverPath resolves a relative path in a server config against the directory of the config file
+func serverPath(server ServerConfig, path string) string {
+	if server.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(server.Dir, path)
+}
+
+// start starts listening, and serves requests in background
+func (l *listener) start() error {
+	ln, err := net.Listen("tcp", l.config.Addr)
+	if err != nil {
+		return err
+	}
+	if l.requestHandler != nil {
+		l.requestHandler.Server.Addr = ln.Addr().String()
+	}
+
+	scheme := "http"
+	if l.httpServer.TLSConfig != nil {
+		scheme = "https"
+		log.Printf("HTTPs server listening on %s, key file: %s, cert file: %s", ln.Addr(), l.config.KeyFile, l.config.CertFile)
+	} else {
+		log.Printf("HTTP server listening on %s", ln.Addr())
+	}
+	l.url = fmt.Sprintf("%s://%s", scheme, hostPort(ln.Addr()))
+
+	go func() {
+		var err error
+		if l.httpServer.TLSConfig != nil {
+			err = l.httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = l.httpServer.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
+			log.Printf("Server %s stopped, err: %s", l.config.Addr, err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// stop stops listening, and waits at most ShutdownTimeout for requests in flight to complete
+func (l *listener) stop() {
+	log.Printf("Stopping server %s...", l.config.Addr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err := l.httpServer.Shutdown(ctx)
+	if err != nil {
+		l.httpServer.Close()
+	}
+}
+
+// hostPort returns the address a client connects to, unspecified hosts like '::' are replaced by the loopback address
+func hostPort(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return net.JoinHostPort("127.0.0.1", fmt.Sprint(tcpAddr.Port))
+}
@@ -0,0 +1,136 @@
+package mockserver_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imafish/http-test-server/pkg/mockserver"
+)
+
+// writeCertificate writes a self-signed certificate of 127.0.0.1 and its key into dir
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "server.cer"), filepath.Join(dir, "server-key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestFaultsOverTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	s := mockserver.StartTest(t, &mockserver.Config{
+		Servers: []mockserver.ServerConfig{
+			{Addr: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile},
+		},
+		Rules: []mockserver.Rule{
+			{
+				Request: mockserver.RequestRule{Method: "GET", Path: "/truncate"},
+				Response: mockserver.ResponseRule{
+					BodyRaw: "0123456789",
+					Fault:   &mockserver.FaultRule{Type: "truncate", After: 3},
+				},
+			},
+		},
+	})
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		},
+	}
+	resp, err := client.Get(s.URL() + "/truncate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 1 {
+		t.Errorf("expected HTTP/1.1 unless http2 is enabled, got %s", resp.Proto)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || err != io.ErrUnexpectedEOF || string(body) != "012" {
+		t.Errorf("expected the response to be truncated after 3 bytes, got %d %q %v", resp.StatusCode, body, err)
+	}
+}
+
+func TestRelativeCertificatePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeCertificate(t, dir)
+
+	s := mockserver.StartTest(t, &mockserver.Config{
+		Servers: []mockserver.ServerConfig{
+			{Addr: "127.0.0.1:0", CertFile: "server.cer", KeyFile: "server-key.pem", Dir: dir},
+		},
+		Rules: []mockserver.Rule{
+			{
+				Request:  mockserver.RequestRule{Method: "GET", Path: "/hello"},
+				Response: mockserver.ResponseRule{BodyRaw: "hello"},
+			},
+		},
+	})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get(s.URL() + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("expected 200 hello, got %d %q", resp.StatusCode, body)
+	}
+}
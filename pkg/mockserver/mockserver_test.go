@@ -0,0 +1,235 @@
+package mockserver_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imafish/http-test-server/pkg/mockserver"
+	"github.com/imafish/http-test-server/pkg/mockserver/stub"
+)
+
+// get requests a URL, and returns the status and body of the response
+func get(t *testing.T, target string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+// checkReleased fails the test unless the address of a server URL can be listened on again
+func checkReleased(t *testing.T, serverURL string) {
+	t.Helper()
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		t.Fatalf("expected %s to be released, err: %s", u.Host, err)
+	}
+	l.Close()
+}
+
+func TestStartTest(t *testing.T) {
+	stubConfig, err := stub.Config(stub.Rule("hello").Get("/hello").Respond(200).Text("hello from stub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		config   *mockserver.Config
+		expected string
+	}{
+		{
+			name: "config",
+			config: &mockserver.Config{
+				Rules: []mockserver.Rule{
+					{
+						Request:  mockserver.RequestRule{Method: "GET", Path: "/hello"},
+						Response: mockserver.ResponseRule{Status: "200", BodyRaw: "hello from config"},
+					},
+				},
+			},
+			expected: "hello from config",
+		},
+		{
+			name:     "stub",
+			config:   stubConfig,
+			expected: "hello from stub",
+		},
+	}
+
+	for _, test := range tests {
+		var serverURL string
+		t.Run(test.name, func(t *testing.T) {
+			s := mockserver.StartTest(t, test.config)
+			serverURL = s.URL()
+
+			u, err := url.Parse(serverURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Port() == "" || u.Port() == "0" {
+				t.Fatalf("expected URL with the ephemeral port, got %s", serverURL)
+			}
+
+			status, body := get(t, serverURL+"/hello")
+			if status != http.StatusOK || body != test.expected {
+				t.Errorf("expected 200 %q, got %d %q", test.expected, status, body)
+			}
+
+			status, _ = get(t, serverURL+"/missing")
+			if status != http.StatusNotFound {
+				t.Errorf("expected 404 for a request no rule matches, got %d", status)
+			}
+		})
+
+		// the server is closed by the cleanup of the subtest
+		checkReleased(t, serverURL)
+	}
+}
+
+func TestClose(t *testing.T) {
+	s, err := mockserver.New(&mockserver.Config{AdminAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverURL, adminURL := s.URL(), s.AdminURL()
+	status, _ := get(t, adminURL+"/__admin/rules")
+	if status != http.StatusOK {
+		t.Errorf("expected the admin listener to serve rules, got %d", status)
+	}
+	status, _ = get(t, serverURL+"/__admin/rules")
+	if status != http.StatusNotFound {
+		t.Errorf("expected a server without admin enabled not to serve admin endpoints, got %d", status)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	err = s.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	err = s.Close()
+	if err != nil {
+		t.Errorf("expected closing twice to succeed, err: %s", err)
+	}
+	checkReleased(t, serverURL)
+	checkReleased(t, adminURL)
+}
+
+func TestReloadReplaysRecordedAgain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recordFile := filepath.Join(dir, "recorded.yaml")
+	record := func(path string) {
+		t.Helper()
+		content := "rules:\n  - request: {method: GET, path: " + path + "}\n    response: {status: 200, body_raw: recorded}\n"
+		err := ioutil.WriteFile(recordFile, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("/first")
+
+	config := &mockserver.Config{
+		Servers: []mockserver.ServerConfig{
+			{Addr: "127.0.0.1:0", Proxy: &mockserver.ProxyConfig{Mode: "replay", File: recordFile}},
+		},
+	}
+	s := mockserver.StartTest(t, config)
+	serverURL := s.URL()
+
+	if status, _ := get(t, serverURL+"/first"); status != http.StatusOK {
+		t.Fatalf("expected the recorded rule to be replayed, got %d", status)
+	}
+
+	record("/second")
+	err = s.Reload(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.URL() != serverURL {
+		t.Errorf("expected the unchanged server to keep running on %s, got %s", serverURL, s.URL())
+	}
+	if status, _ := get(t, serverURL+"/second"); status != http.StatusOK {
+		t.Errorf("expected the rule recorded again to be replayed, got %d", status)
+	}
+	if status, _ := get(t, serverURL+"/first"); status != http.StatusNotFound {
+		t.Errorf("expected the old recorded rule to be gone, got %d", status)
+	}
+}
+
+func TestReloadDiscardsRuntimeChanges(t *testing.T) {
+	config := &mockserver.Config{
+		Servers: []mockserver.ServerConfig{{Addr: "127.0.0.1:0", Admin: true}},
+		Rules: []mockserver.Rule{
+			{
+				Request:  mockserver.RequestRule{Method: "GET", Path: "/order"},
+				Response: mockserver.ResponseRule{BodyRaw: "created"},
+				Scenario: "checkout",
+				NewState: "created",
+			},
+		},
+	}
+	s := mockserver.StartTest(t, config)
+	serverURL := s.URL()
+
+	resp, err := http.Post(serverURL+"/__admin/rules", "application/json", strings.NewReader(`{"request": {"method": "GET", "path": "/hello"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Warning") == "" {
+		t.Fatalf("expected the rule to be created with a warning, got %d %q", resp.StatusCode, resp.Header.Get("Warning"))
+	}
+	get(t, serverURL+"/order")
+	if _, body := get(t, serverURL+"/__admin/scenarios"); body != `{"checkout":"created"}` {
+		t.Fatalf("expected the scenario to be changed, got %s", body)
+	}
+
+	err = s.Reload(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status, _ := get(t, serverURL+"/hello"); status != http.StatusNotFound {
+		t.Errorf("expected the rule created at runtime to be discarded, got %d", status)
+	}
+	if _, body := get(t, serverURL+"/__admin/scenarios"); body != `{"checkout":"Started"}` {
+		t.Errorf("expected the scenario to be started again, got %s", body)
+	}
+}
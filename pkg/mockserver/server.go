@@ -0,0 +1,388 @@
+// Package mockserver runs mock HTTP servers in process, serving responses by rules of a config.
+// It's what the http-test-server binary runs, and can be embedded in Go tests instead of running the binary.
+package mockserver
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/imafish/http-test-server/internal/delay"
+	"github.com/imafish/http-test-server/internal/handler"
+	"github.com/imafish/http-test-server/internal/journal"
+	"github.com/imafish/http-test-server/internal/proxy"
+	"github.com/imafish/http-test-server/internal/rules"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultAddr is the address of the server started if a config has no servers, it listens on an ephemeral port
+const DefaultAddr = "127.0.0.1:0"
+
+// Server runs all servers of a config, sharing the same rules.
+type Server struct {
+	config  *Config
+	rules   *rules.AtomicRuleSet
+	journal *journal.Journal
+	admin   *handler.AdminHandler
+	reloads *handler.ReloadStatus
+
+	reloadMtx sync.Mutex // serializes reloads, e.g. by the config file watcher and SIGHUP
+
+	mtx       sync.Mutex // guards listeners and closed, held while servers are started or stopped
+	listeners []*listener
+	adminLn   *listener
+	closed    bool
+	done      chan struct{}
+
+	watchersMtx sync.Mutex
+	watchers    []*fsnotify.Watcher
+}
+
+// New creates a Server from a config, compiling its rules. Servers aren't started until Start is called.
+// If the config has no servers, a server listening on DefaultAddr is started.
+func New(config *Config) (*Server, error) {
+	err := validateConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	compiledRules, err := compileRules(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		config:  config,
+		rules:   rules.NewAtomicRuleSet(rules.NewRuleSet(compiledRules)),
+		reloads: &handler.ReloadStatus{},
+		done:    make(chan struct{}),
+	}
+	s.reloads.Succeeded(len(compiledRules))
+	s.journal = journal.New(config.JournalSize)
+	s.admin = &handler.AdminHandler{
+		Rules:   s.rules,
+		Journal: s.journal,
+		Dir:     config.Dir,
+		Reloads: s.reloads,
+	}
+	return s, nil
+}
+
+// Start starts listening on addresses of all servers, and serves requests in background.
+// Addresses with port 0 listen on ephemeral ports, URL returns the actual address.
+func (s *Server) Start() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for _, server := range serversOf(s.config) {
+		l, err := s.newListener(server)
+		if err == nil {
+			err = l.start()
+		}
+		if err != nil {
+			s.stopAll()
+			return err
+		}
+		s.listeners = append(s.listeners, l)
+	}
+
+	if s.config.AdminAddr != "" {
+		l := &listener{
+			config:     ServerConfig{Addr: s.config.AdminAddr},
+			httpServer: &http.Server{Handler: s.admin},
+		}
+		err := l.start()
+		if err != nil {
+			s.stopAll()
+			return err
+		}
+		s.adminLn = l
+	}
+
+	return nil
+}
+
+// serversOf returns servers of a config, or a server listening on DefaultAddr if it has none
+func serversOf(config *Config) []ServerConfig {
+	if len(config.Servers) == 0 {
+		return []ServerConfig{{Addr: DefaultAddr, Dir: config.Dir}}
+	}
+	return config.Servers
+}
+
+// requestHandler creates the handler of a server
+func (s *Server) requestHandler(server ServerConfig) (*handler.RequestHandler, error) {
+	serverDelay, err := delay.Compile(server.Delay)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile delay of server %s, err: %s", server.Addr, err.Error())
+	}
+
+	h := &handler.RequestHandler{
+		Rules:   s.rules,
+		Server:  server,
+		Delay:   serverDelay,
+		Journal: s.journal,
+	}
+	if server.Admin {
+		h.Admin = s.admin
+	}
+
+	if server.Proxy != nil {
+		switch server.Proxy.Mode {
+		case "record":
+			h.Proxy, err = proxy.NewRecorder(*server.Proxy, server.Dir)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to create proxy of server %s, err: %s", server.Addr, err.Error())
+			}
+			log.Printf("Server %s records responses of %s into %s", server.Addr, server.Proxy.Upstream, proxy.RecordFile(*server.Proxy, server.Dir))
+
+		case "replay":
+			recorded, err := loadRecordedRules(proxy.RecordFile(*server.Proxy, server.Dir))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to load recorded rules of server %s, err: %s", server.Addr, err.Error())
+			}
+			h.Rules = rules.NewAtomicRuleSet(recorded)
+		}
+	}
+
+	return h, nil
+}
+
+// URL returns the base URL of the first server, e.g. http://127.0.0.1:41234
+func (s *Server) URL() string {
+	urls := s.URLs()
+	if len(urls) == 0 {
+		return ""
+	}
+	return urls[0]
+}
+
+// URLs returns base URLs of all running servers, in the order of the config
+func (s *Server) URLs() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	urls := make([]string, len(s.listeners))
+	for i, l := range s.listeners {
+		urls[i] = l.url
+	}
+	return urls
+}
+
+// AdminURL returns the base URL of the admin listener, empty if the config has no admin_addr
+func (s *Server) AdminURL() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.adminLn == nil {
+		return ""
+	}
+	return s.adminLn.url
+}
+
+// Wait blocks until the server is closed
+func (s *Server) Wait() {
+	<-s.done
+}
+
+// Close stops all servers immediately, closing active connections, and stops watching config files
+func (s *Server) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	s.watchersMtx.Lock()
+	for _, watcher := range s.watchers {
+		watcher.Close()
+	}
+	s.watchersMtx.Unlock()
+
+	err := s.stopAll()
+	close(s.done)
+	return err
+}
+
+// stopAll closes all listeners immediately, s.mtx must be held
+func (s *Server) stopAll() error {
+	var err error
+	for _, l := range s.listeners {
+		if closeErr := l.httpServer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if s.adminLn != nil {
+		if closeErr := s.adminLn.httpServer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	s.listeners = nil
+	s.adminLn = nil
+	return err
+}
+
+// reloadRecordedRules replaces rules of a server in replay mode by rules in its record file.
+// If the file fails to load, the current rules are kept.
+func reloadRecordedRules(l *listener) error {
+	server := l.config
+	if server.Proxy == nil || server.Proxy.Mode != "replay" {
+		return nil
+	}
+
+	recorded, err := loadRecordedRules(proxy.RecordFile(*server.Proxy, server.Dir))
+	if err != nil {
+		return fmt.Errorf("Failed to load recorded rules of server %s, err: %s", server.Addr, err.Error())
+	}
+	l.requestHandler.Rules.Store(recorded)
+	return nil
+}
+
+// ReloadRules replaces rules by rules of another config, e.g. when the config file is changed.
+// Servers of the config are ignored. If the rules fail to compile, the current rules are kept.
+// The result is reported by the /__admin/reload endpoint.
+func (s *Server) ReloadRules(config *Config) error {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	return s.reloadRules(config)
+}
+
+func (s *Server) reloadRules(config *Config) error {
+	compiledRules, err := compileRules(config)
+	if err != nil {
+		s.reloads.Failed(err)
+		return err
+	}
+
+	s.rules.Store(rules.NewRuleSet(compiledRules))
+	s.reloads.Succeeded(len(compiledRules))
+	return nil
+}
+
+// Reload replaces rules and servers by those of another config.
+// Servers are matched by address: new servers are started, removed servers are stopped gracefully,
+// and changed servers are restarted. Rules of unchanged servers in replay mode are loaded from their record files again.
+// A server failing to start is reported, other servers keep running.
+// The admin listener and the journal are kept as they are.
+func (s *Server) Reload(config *Config) error {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+	return s.reload(config)
+}
+
+func (s *Server) reload(config *Config) error {
+	err := validateConfig(config)
+	if err == nil && len(config.Servers) == 0 && len(s.config.Servers) > 0 {
+		err = fmt.Errorf("server count must be greater than 1")
+	}
+	if err != nil {
+		s.reloads.Failed(err)
+		return err
+	}
+
+	err = s.reloadRules(config)
+	if err != nil {
+		return err
+	}
+
+	err = s.reloadServers(serversOf(config))
+	if err != nil {
+		s.reloads.Failed(err)
+		return err
+	}
+	return nil
+}
+
+// ReloadConfigFile loads a config file and replaces rules and servers by its rules and servers, see Reload.
+// Concurrent reloads run one after another, so the file read last is the one loaded.
+func (s *Server) ReloadConfigFile(configPath string) error {
+	s.reloadMtx.Lock()
+	defer s.reloadMtx.Unlock()
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		s.reloads.Failed(err)
+		return err
+	}
+	return s.reload(config)
+}
+
+// reloadServers diffs running servers against servers, and starts, stops or restarts servers to match them
+func (s *Server) reloadServers(servers []ServerConfig) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	running := make(map[string]*listener, len(s.listeners))
+	for _, l := range s.listeners {
+		running[l.config.Addr] = l
+	}
+	kept := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		kept[server.Addr] = true
+	}
+
+	// removed servers are stopped first, so their ports are free for new servers
+	for _, l := range s.listeners {
+		if !kept[l.config.Addr] {
+			log.Printf("Server %s removed", l.config.Addr)
+			l.stop()
+			delete(running, l.config.Addr)
+		}
+	}
+
+	failures := make([]string, 0)
+	listeners := make([]*listener, 0, len(servers))
+	for _, server := range servers {
+		old := running[server.Addr]
+		delete(running, server.Addr)
+		if old != nil && reflect.DeepEqual(old.config, server) {
+			// the record file may have been recorded again, so it's reloaded even if the server is unchanged
+			err := reloadRecordedRules(old)
+			if err != nil {
+				failures = append(failures, err.Error())
+			}
+			listeners = append(listeners, old)
+			continue
+		}
+
+		l, err := s.newListener(server)
+		if err != nil {
+			// the old server keeps running with its old config
+			failures = append(failures, err.Error())
+			if old != nil {
+				listeners = append(listeners, old)
+			}
+			continue
+		}
+
+		if old != nil {
+			log.Printf("Server %s changed, restarting", server.Addr)
+			old.stop()
+		} else {
+			log.Printf("Server %s added", server.Addr)
+		}
+
+		err = l.start()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Failed to start server %s, err: %s", server.Addr, err.Error()))
+			continue
+		}
+		listeners = append(listeners, l)
+	}
+	s.listeners = listeners
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package stub builds rules in Go code, e.g.
+//
+//	stub.Rule("create").Post("/users/{id:int}").Header("Content-Type", "application/json").
+//		BodyLoose(map[string]interface{}{"name": "{{name,string}}"}).
+//		Respond(201).JSON(map[string]interface{}{"id": "{{id}}"})
+//
+// Built rules are the same as rules written in a config file, and can be written into YAML.
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/imafish/http-test-server/internal/config"
+	"github.com/imafish/http-test-server/internal/rules"
+	"github.com/imafish/http-test-server/pkg/mockserver"
+
+	"gopkg.in/yaml.v2"
+)
+
+const packagePath = "github.com/imafish/http-test-server/pkg/mockserver/stub"
+
+// RuleBuilder builds a rule call by call.
+// Every call is validated when it's made, the first error is kept and reported by Build, pointing at the failed call.
+type RuleBuilder struct {
+	rule config.Rule
+	err  error
+}
+
+// Rule starts building a rule with a name
+func Rule(name string) *RuleBuilder {
+	return &RuleBuilder{rule: config.Rule{Name: name}}
+}
+
+// ID sets the id identifying the rule in the admin API
+func (b *RuleBuilder) ID(id string) *RuleBuilder {
+	b.rule.ID = id
+	return b
+}
+
+// Method matches requests of a method and a path. The path is written the same as in a config file
+func (b *RuleBuilder) Method(method string, path string) *RuleBuilder {
+	return b.route("Method", method, path)
+}
+
+// Get matches GET requests of a path
+func (b *RuleBuilder) Get(path string) *RuleBuilder {
+	return b.route("Get", "GET", path)
+}
+
+// Post matches POST requests of a path
+func (b *RuleBuilder) Post(path string) *RuleBuilder {
+	return b.route("Post", "POST", path)
+}
+
+// Put matches PUT requests of a path
+func (b *RuleBuilder) Put(path string) *RuleBuilder {
+	return b.route("Put", "PUT", path)
+}
+
+// Patch matches PATCH requests of a path
+func (b *RuleBuilder) Patch(path string) *RuleBuilder {
+	return b.route("Patch", "PATCH", path)
+}
+
+// Delete matches DELETE requests of a path
+func (b *RuleBuilder) Delete(path string) *RuleBuilder {
+	return b.route("Delete", "DELETE", path)
+}
+
+func (b *RuleBuilder) route(call string, method string, path string) *RuleBuilder {
+	return b.request(call, func(r *config.RequestRule) {
+		r.Method = method
+		r.Path = path
+	})
+}
+
+// Query matches a query parameter exactly, '{{name,type}}' captures a variable
+func (b *RuleBuilder) Query(name string, value string) *RuleBuilder {
+	return b.request("Query", func(r *config.RequestRule) {
+		r.Query = append(r.Query, config.QueryRule{Name: name, Value: value})
+	})
+}
+
+// QueryRegex matches a query parameter by a regex
+func (b *RuleBuilder) QueryRegex(name string, regex string) *RuleBuilder {
+	return b.request("QueryRegex", func(r *config.RequestRule) {
+		r.Query = append(r.Query, config.QueryRule{Name: name, Regex: regex})
+	})
+}
+
+// Header matches a header exactly, '{{name,type}}' captures a variable
+func (b *RuleBuilder) Header(name string, value string) *RuleBuilder {
+	return b.request("Header", func(r *config.RequestRule) {
+		r.Headers = append(r.Headers, config.HeaderRule{Name: name, Value: value})
+	})
+}
+
+// HeaderRegex matches a header by a regex
+func (b *RuleBuilder) HeaderRegex(name string, regex string) *RuleBuilder {
+	return b.request("HeaderRegex", func(r *config.RequestRule) {
+		r.Headers = append(r.Headers, config.HeaderRule{Name: name, Regex: regex})
+	})
+}
+
+// BodyLoose matches request bodies containing all fields of value, strings are matched as regexes.
+// value is anything encoding/json marshals.
+func (b *RuleBuilder) BodyLoose(value interface{}) *RuleBuilder {
+	return b.body("BodyLoose", "loose", value)
+}
+
+// BodyStrict matches request bodies equal to value. value is anything encoding/json marshals.
+func (b *RuleBuilder) BodyStrict(value interface{}) *RuleBuilder {
+	return b.body("BodyStrict", "strict", value)
+}
+
+func (b *RuleBuilder) body(call string, matchRule string, value interface{}) *RuleBuilder {
+	converted, err := yamlValue(value)
+	if err != nil {
+		return b.fail(call, err)
+	}
+	return b.request(call, func(r *config.RequestRule) {
+		r.Body = config.RequestBodyRule{MatchRule: matchRule, Value: converted}
+	})
+}
+
+// Scenario makes the rule take part in a scenario, it only matches in state, and transitions the scenario to newState.
+// Empty state matches any state, empty newState keeps the state.
+func (b *RuleBuilder) Scenario(name string, state string, newState string) *RuleBuilder {
+	b.rule.Scenario = name
+	b.rule.State = state
+	b.rule.NewState = newState
+	return b
+}
+
+// Respond sets the status code of the response
+func (b *RuleBuilder) Respond(status int) *RuleBuilder {
+	return b.response("Respond", func(r *config.ResponseRule) {
+		r.Status = config.StatusCode(fmt.Sprint(status))
+	})
+}
+
+// ResponseHeader adds a header to the response
+func (b *RuleBuilder) ResponseHeader(name string, value string) *RuleBuilder {
+	return b.response("ResponseHeader", func(r *config.ResponseRule) {
+		r.Headers = append(r.Headers, fmt.Sprintf("%s: %s", name, value))
+	})
+}
+
+// JSON sets the response body to value marshaled into JSON, Content-Type defaults to application/json.
+// Strings in value are templates, the same as in a config file.
+func (b *RuleBuilder) JSON(value interface{}) *RuleBuilder {
+	converted, err := yamlValue(value)
+	if err != nil {
+		return b.fail("JSON", err)
+	}
+	return b.response("JSON", func(r *config.ResponseRule) {
+		r.Body = converted
+	})
+}
+
+// Text sets the response body to a text template
+func (b *RuleBuilder) Text(text string) *RuleBuilder {
+	return b.response("Text", func(r *config.ResponseRule) {
+		r.BodyRaw = text
+	})
+}
+
+// File sets the response body to content of a file
+func (b *RuleBuilder) File(path string) *RuleBuilder {
+	return b.response("File", func(r *config.ResponseRule) {
+		r.File = path
+	})
+}
+
+// Delay delays the response for a fixed duration
+func (b *RuleBuilder) Delay(d time.Duration) *RuleBuilder {
+	return b.response("Delay", func(r *config.ResponseRule) {
+		r.Delay = &config.DelayRule{Fixed: d}
+	})
+}
+
+// Build returns the built rule, or the first error found.
+// The rule is compiled to validate it, mockserver compiles it again the same way as a rule from a config file.
+func (b *RuleBuilder) Build() (mockserver.Rule, error) {
+	if b.err != nil {
+		return b.rule, b.err
+	}
+
+	_, err := rules.CompileRule(b.rule)
+	if err != nil {
+		return b.rule, fmt.Errorf("%s: Build: %s", caller(), err.Error())
+	}
+	return b.rule, nil
+}
+
+// MustBuild is like Build but panics on error
+func (b *RuleBuilder) MustBuild() mockserver.Rule {
+	rule, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return rule
+}
+
+// YAML writes the built rule into YAML, the same as it's written in a config file
+func (b *RuleBuilder) YAML() ([]byte, error) {
+	rule, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(rule)
+}
+
+// Config builds rules into a config, which has no servers so it can be used by mockserver.StartTest,
+// or written into YAML to be shared as a config file
+func Config(builders ...*RuleBuilder) (*mockserver.Config, error) {
+	c := &mockserver.Config{}
+	for _, b := range builders {
+		rule, err := b.Build()
+		if err != nil {
+			return nil, err
+		}
+		c.Rules = append(c.Rules, rule)
+	}
+	return c, nil
+}
+
+// request changes the request rule by set, and validates the change by compiling a rule of only the request
+func (b *RuleBuilder) request(call string, set func(r *config.RequestRule)) *RuleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	set(&b.rule.Request)
+	_, err := rules.CompileRule(config.Rule{Request: b.rule.Request})
+	if err != nil {
+		return b.fail(call, err)
+	}
+	return b
+}
+
+// response changes the response rule by set, and validates the change by compiling a rule of only the response
+func (b *RuleBuilder) response(call string, set func(r *config.ResponseRule)) *RuleBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	set(&b.rule.Response)
+	_, err := rules.CompileRule(config.Rule{Response: b.rule.Response})
+	if err != nil {
+		return b.fail(call, err)
+	}
+	return b
+}
+
+// fail records err of a call, with the position of the call in the caller's code
+func (b *RuleBuilder) fail(call string, err error) *RuleBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("%s: %s: %s", caller(), call, err.Error())
+	}
+	return b
+}
+
+// caller returns file:line of the first caller outside this package, which made the builder call
+func caller() string {
+	pc := make([]uintptr, 16)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePath+".") {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// yamlValue converts a Go value into the types a value decoded from a config file has.
+// The value is marshaled into JSON first, so json tags of structs are used.
+func yamlValue(value interface{}) (interface{}, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted interface{}
+	err = yaml.Unmarshal(bytes, &converted)
+	if err != nil {
+		return nil, err
+	}
+	return converted, nil
+}
@@ -0,0 +1,89 @@
+package stub_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/imafish/http-test-server/pkg/mockserver"
+	"github.com/imafish/http-test-server/pkg/mockserver/stub"
+
+	"gopkg.in/yaml.v2"
+)
+
+func createUser() *stub.RuleBuilder {
+	return stub.Rule("create").Post("/users/{id:int}").Header("Content-Type", "application/json").
+		BodyLoose(map[string]interface{}{"name": "{{name,string}}"}).
+		Respond(201).JSON(map[string]interface{}{"id": "{{id}}", "name": "{{name}}"})
+}
+
+func TestBuiltRuleServesRequests(t *testing.T) {
+	config, err := stub.Config(createUser())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := mockserver.StartTest(t, config)
+
+	resp, err := http.Post(s.URL()+"/users/7", "application/json", strings.NewReader(`{"name": "bob"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected status 201, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header["Content-Type"]; !reflect.DeepEqual(contentType, []string{"application/json"}) {
+		t.Errorf("expected a single application/json Content-Type, got %v", contentType)
+	}
+	if !strings.Contains(string(body), `"name":"bob"`) {
+		t.Errorf("expected the captured name in the body, got %s", body)
+	}
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	b := createUser()
+	rule, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rule.Response.Headers) != 0 {
+		t.Errorf("expected JSON to rely on the default Content-Type, got headers %v", rule.Response.Headers)
+	}
+
+	bytes, err := b.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded mockserver.Rule
+	err = yaml.Unmarshal(bytes, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(rule, decoded) {
+		t.Errorf("expected the rule decoded from YAML to equal the built rule\nbuilt: %#v\ndecoded: %#v", rule, decoded)
+	}
+}
+
+func TestBuildReportsFailedCall(t *testing.T) {
+	_, file, line, _ := runtime.Caller(0)
+	b := stub.Rule("invalid").Get("/users").QueryRegex("q", "(").Respond(200)
+
+	_, err := b.Build()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	position := fmt.Sprintf("%s:%d: QueryRegex:", file[strings.LastIndex(file, "/")+1:], line+1)
+	if !strings.HasPrefix(err.Error(), position) {
+		t.Errorf("expected the error to start with %s, got %s", position, err)
+	}
+}
@@ -0,0 +1,29 @@
+package mockserver
+
+// TB is the subset of testing.TB used by StartTest
+type TB interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// StartTest creates and starts a Server for a test, it's closed when the test and its subtests complete.
+// The test fails immediately if the server can't be started.
+func StartTest(t TB, config *Config) *Server {
+	t.Helper()
+
+	s, err := New(config)
+	if err != nil {
+		t.Fatalf("Failed to create mock server, err: %s", err.Error())
+	}
+
+	err = s.Start()
+	if err != nil {
+		t.Fatalf("Failed to start mock server, err: %s", err.Error())
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+	})
+	return s
+}
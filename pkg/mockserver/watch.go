@@ -0,0 +1,73 @@
+package mockserver
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadDebounce is how long a config file must stay unchanged before it's reloaded,
+// so a burst of writes reloads once, after the file is completely written
+const ReloadDebounce = 200 * time.Millisecond
+
+// WatchConfigFile reloads rules whenever the config file is changed, until the server is closed.
+// The directory of the file is watched rather than the file, so editors saving by renaming a new file over it
+// keep triggering reloads.
+func (s *Server) WatchConfigFile(configPath string) error {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	err = watcher.Add(filepath.Dir(absPath))
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+
+	s.watchersMtx.Lock()
+	s.watchers = append(s.watchers, watcher)
+	s.watchersMtx.Unlock()
+
+	log.Printf("Starting to watch for config file change...")
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != absPath || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+
+				if timer == nil {
+					timer = time.AfterFunc(ReloadDebounce, func() {
+						log.Printf("\n------- ------- -------")
+						log.Printf("config file changed, reloading...")
+						s.ReloadConfigFile(absPath)
+					})
+				} else {
+					timer.Reset(ReloadDebounce)
+				}
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("erro watching config file: %s", err)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package mockserver_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imafish/http-test-server/pkg/mockserver"
+)
+
+// writeConfig writes a config with an admin listener and a rule responding body to GET /hello
+func writeConfig(t *testing.T, configPath string, body string) {
+	t.Helper()
+
+	content := fmt.Sprintf(`
+admin_addr: "127.0.0.1:0"
+servers:
+  - addr: "127.0.0.1:0"
+rules:
+  - request: {method: GET, path: /hello}
+    response: {body_raw: %s}
+`, body)
+	err := ioutil.WriteFile(configPath, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startConfigFile starts a server of a config file
+func startConfigFile(t *testing.T, configPath string) *mockserver.Server {
+	t.Helper()
+
+	config, err := mockserver.LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mockserver.StartTest(t, config)
+}
+
+// reloadLoads returns the number of successful loads reported by the admin listener
+func reloadLoads(t *testing.T, s *mockserver.Server) int {
+	t.Helper()
+
+	_, body := get(t, s.AdminURL()+"/__admin/reload")
+	report := struct {
+		Loads    int `json:"loads"`
+		Failures int `json:"failures"`
+	}{}
+	err := json.Unmarshal([]byte(body), &report)
+	if err != nil {
+		t.Fatalf("expected a JSON report, got %s", body)
+	}
+	if report.Failures != 0 {
+		t.Errorf("expected no failed loads, got %s", body)
+	}
+	return report.Loads
+}
+
+func TestWatchConfigFileDebounces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config.yaml")
+	writeConfig(t, configPath, "first")
+
+	s := startConfigFile(t, configPath)
+	err = s.WatchConfigFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, configPath, "second")
+	time.Sleep(mockserver.ReloadDebounce / 4)
+	writeConfig(t, configPath, "third")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for reloadLoads(t, s) < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	// long enough for a second reload to happen, if writes weren't debounced
+	time.Sleep(2 * mockserver.ReloadDebounce)
+
+	if loads := reloadLoads(t, s); loads != 2 {
+		t.Errorf("expected the initial load and a single reload, got %d loads", loads)
+	}
+	if _, body := get(t, s.URL()+"/hello"); body != "third" {
+		t.Errorf("expected the last written rule to be loaded, got %q", body)
+	}
+}
+
+func TestConcurrentReloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configPath := filepath.Join(dir, "config.yaml")
+	writeConfig(t, configPath, "hello")
+
+	s := startConfigFile(t, configPath)
+	serverURL := s.URL()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.ReloadConfigFile(configPath)
+			if err != nil {
+				t.Errorf("failed to reload, err: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads := reloadLoads(t, s); loads != 11 {
+		t.Errorf("expected 11 loads, got %d", loads)
+	}
+	if len(s.URLs()) != 1 || s.URL() != serverURL {
+		t.Errorf("expected the unchanged server to keep running on %s, got %v", serverURL, s.URLs())
+	}
+	if _, body := get(t, serverURL+"/hello"); body != "hello" {
+		t.Errorf("expected the rule to be served, got %q", body)
+	}
+}